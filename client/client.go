@@ -1,32 +1,168 @@
-package main
+package client
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"http/internal/headers"
+	"io"
 	"net"
+	"net/url"
+	"strings"
+	"time"
 )
 
-func main() {
-	conn, err := net.Dial("tcp", "localhost:42069")
+var ErrUnsupportedScheme = errors.New("unsupported scheme")
+
+// Client sends requests through a Transport, which reuses connections to the
+// same host once a response body has been read.
+type Client struct {
+	// Transport holds the connection pool. DefaultTransport is used if nil.
+	Transport *Transport
+	// Timeout bounds dialing and the whole exchange, including reading the
+	// response body. Zero means no timeout.
+	Timeout time.Duration
+}
+
+type Request struct {
+	Method string
+	// Host is the host:port to connect to, also sent as the host header.
+	Host string
+	// Target is the request-target, such as /path?query.
+	Target  string
+	Headers *headers.Headers
+	Body    io.Reader
+	// ContentLength is the size of Body, or -1 if it isn't known in which
+	// case the body is sent chunked.
+	ContentLength int64
+}
+
+// NewRequest builds a request for an http:// URL. The content length is
+// filled in for bodies whose size is known up front.
+func NewRequest(method, rawURL string, body io.Reader) (*Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedScheme, u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "80")
+	}
+	req := &Request{
+		Method:  method,
+		Host:    host,
+		Target:  u.RequestURI(),
+		Headers: headers.NewHeaders(),
+		Body:    body,
+	}
+	switch b := body.(type) {
+	case nil:
+	case *bytes.Buffer:
+		req.ContentLength = int64(b.Len())
+	case *bytes.Reader:
+		req.ContentLength = int64(b.Len())
+	case *strings.Reader:
+		req.ContentLength = int64(b.Len())
+	default:
+		req.ContentLength = -1
+	}
+	return req, nil
+}
+
+func (c *Client) Get(rawURL string) (*Response, error) {
+	req, err := NewRequest("GET", rawURL, nil)
 	if err != nil {
-		fmt.Printf("Error dialing: %v\n", err)
-		return
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+func (c *Client) Post(rawURL, contentType string, body io.Reader) (*Response, error) {
+	req, err := NewRequest("POST", rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Headers.Set("content-type", contentType)
+	return c.Do(req)
+}
+
+// Do sends req and reads the response status and headers. The caller must
+// close the response body so the connection can be reused or closed.
+func (c *Client) Do(req *Request) (*Response, error) {
+	t := c.Transport
+	if t == nil {
+		t = DefaultTransport
+	}
+	return t.roundTrip(req, c.Timeout)
+}
+
+// writeRequest serializes req, asking the server to close the connection
+// afterwards unless keepAlive is set.
+func writeRequest(w *bufio.Writer, req *Request, keepAlive bool) error {
+	h := req.Headers
+	if h == nil {
+		h = headers.NewHeaders()
+	}
+	all := headers.NewHeaders()
+	if !h.Has("host") {
+		all.Set("host", req.Host)
+	}
+	for _, f := range h.Fields() {
+		all.Add(f.Name, f.Value)
+	}
+	chunked := req.Body != nil && req.ContentLength < 0
+	if req.Body != nil && !h.Has("content-length") && !h.Has("transfer-encoding") {
+		if chunked {
+			all.Set("transfer-encoding", "chunked")
+		} else {
+			all.Set("content-length", fmt.Sprintf("%d", req.ContentLength))
+		}
+	}
+	if !keepAlive && !h.Has("connection") {
+		all.Set("connection", "close")
 	}
-	defer conn.Close()
 
-	messages := []string{
-		"Hello, World!\n",
-		"This is a test message.\n",
-		"Goodbye!\n",
-		"Test",
-		" without newline",
-		" does this work?\n",
+	fmt.Fprintf(w, "%s %s HTTP/1.1\r\n", req.Method, req.Target)
+	for _, f := range all.Fields() {
+		fmt.Fprintf(w, "%s: %s\r\n", f.Name, f.Value)
+	}
+	w.WriteString(headers.SEPARATOR)
+	if req.Body == nil {
+		return nil
+	}
+	if chunked {
+		return writeChunked(w, req.Body)
+	}
+	n, err := io.Copy(w, io.LimitReader(req.Body, req.ContentLength))
+	if err != nil {
+		return err
 	}
+	if n != req.ContentLength {
+		return fmt.Errorf("request body is %d bytes, content length is %d", n, req.ContentLength)
+	}
+	return nil
+}
 
-	for _, msg := range messages {
-		_, err := conn.Write([]byte(msg))
+func writeChunked(w *bufio.Writer, body io.Reader) error {
+	buf := make([]byte, 4096)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			fmt.Fprintf(w, "%x\r\n", n)
+			w.Write(buf[:n])
+			w.WriteString(headers.SEPARATOR)
+		}
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			fmt.Printf("Error writing to connection: %v\n", err)
-			return
+			return err
 		}
 	}
+	_, err := w.WriteString("0\r\n\r\n")
+	return err
 }
@@ -0,0 +1,169 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"http/internal/headers"
+	"http/internal/request"
+	"http/internal/response"
+	"http/internal/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startServer(t *testing.T, handler server.Handler, opts ...server.Option) string {
+	s, err := server.Serve(0, handler, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return fmt.Sprintf("http://%s", s.Addr())
+}
+
+// rawServer answers a single connection with reply once the request headers
+// have arrived, then closes it.
+func rawServer(t *testing.T, reply string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil || line == "\r\n" {
+				break
+			}
+		}
+		io.WriteString(conn, reply)
+	}()
+	return fmt.Sprintf("http://%s", l.Addr())
+}
+
+func echo(w *response.Writer, req *request.Request) {
+	body, err := io.ReadAll(req.BodyReader)
+	if err != nil {
+		return
+	}
+	w.Header().Set("x-method", req.RequestLine.Method)
+	w.Header().Set("x-target", req.RequestLine.RequestTarget)
+	w.Write(body)
+}
+
+// onlyReader hides the type of r so its length isn't known.
+type onlyReader struct {
+	io.Reader
+}
+
+func TestClientGet(t *testing.T) {
+	url := startServer(t, echo)
+	c := &Client{}
+
+	resp, err := c.Get(url + "/path?q=1")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, response.StatusCode200, resp.StatusCode)
+	assert.Equal(t, "OK", resp.Status)
+	assert.Equal(t, int64(0), resp.ContentLength)
+	target, _ := resp.Headers.Get("x-target")
+	assert.Equal(t, "/path?q=1", target)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Empty(t, body)
+}
+
+func TestClientPost(t *testing.T) {
+	url := startServer(t, echo)
+	c := &Client{}
+
+	resp, err := c.Post(url+"/echo", "text/plain", strings.NewReader("hello"))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "hello", string(body))
+	assert.Equal(t, int64(5), resp.ContentLength)
+
+	// A body of unknown length is sent chunked
+	long := strings.Repeat("abcdefgh", 2000)
+	resp, err = c.Post(url+"/echo", "text/plain", onlyReader{strings.NewReader(long)})
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, long, string(body))
+	assert.Equal(t, int64(-1), resp.ContentLength)
+}
+
+func TestClientChunkedTrailers(t *testing.T) {
+	url := startServer(t, func(w *response.Writer, req *request.Request) {
+		h := headers.NewHeaders()
+		h.Set("transfer-encoding", "chunked")
+		h.Set("trailer", "x-checksum")
+		w.WriteStatusLine(response.StatusCode200)
+		w.WriteHeaders(h)
+		body := w.ChunkedBody()
+		body.Write([]byte("hello "))
+		body.Write([]byte("world"))
+		trailers := headers.NewHeaders()
+		trailers.Set("x-checksum", "abc")
+		body.CloseWithTrailers(trailers)
+	})
+	c := &Client{}
+
+	resp, err := c.Get(url + "/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	_, ok := resp.Trailers.Get("x-checksum")
+	assert.False(t, ok)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(body))
+	checksum, _ := resp.Trailers.Get("x-checksum")
+	assert.Equal(t, "abc", checksum)
+}
+
+func TestClientRawResponses(t *testing.T) {
+	c := &Client{}
+
+	// Interim responses are skipped and the body runs to the end of the connection
+	url := rawServer(t, "HTTP/1.1 100 Continue\r\n\r\n"+
+		"HTTP/1.1 200 OK\r\nx-test: 1\r\n\r\nuntil close")
+	resp, err := c.Get(url)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, response.StatusCode200, resp.StatusCode)
+	assert.Equal(t, "until close", string(body))
+
+	// Connection closed before the content length was reached
+	url = rawServer(t, "HTTP/1.1 200 OK\r\ncontent-length: 10\r\n\r\nshort")
+	resp, err = c.Get(url)
+	require.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	resp.Body.Close()
+
+	url = rawServer(t, "HTTP/1.1 2OO OK\r\n\r\n")
+	_, err = c.Get(url)
+	assert.ErrorIs(t, err, response.ErrInvalidStatusLine)
+
+	url = rawServer(t, "HTTP/1.1 200 OK\r\ntransfer-encoding: chunked\r\n\r\nzz\r\n")
+	resp, err = c.Get(url)
+	require.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	assert.ErrorIs(t, err, response.ErrInvalidChunk)
+	resp.Body.Close()
+
+	_, err = c.Get("https://localhost/")
+	assert.ErrorIs(t, err, ErrUnsupportedScheme)
+}
@@ -0,0 +1,31 @@
+package client
+
+import (
+	"http/internal/headers"
+	"http/internal/response"
+	"io"
+)
+
+type Response struct {
+	StatusCode response.StatusCode
+	// Status is the reason phrase sent after the status code.
+	Status  string
+	Headers *headers.Headers
+	// Trailers holds the trailer fields of a chunked body once Body has been
+	// read to the end.
+	Trailers *headers.Headers
+	// ContentLength is the size of Body, or -1 if it isn't known up front.
+	ContentLength int64
+	Body          io.ReadCloser
+}
+
+func newResponse(resp *response.Response) *Response {
+	return &Response{
+		StatusCode:    resp.StatusLine.StatusCode,
+		Status:        resp.StatusLine.ReasonPhrase,
+		Headers:       resp.Headers,
+		Trailers:      resp.Trailers,
+		ContentLength: resp.ContentLength,
+		Body:          resp.BodyReader,
+	}
+}
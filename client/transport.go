@@ -0,0 +1,317 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"http/internal/response"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 2
+	DefaultIdleConnTimeout     = 90 * time.Second
+)
+
+var DefaultTransport = NewTransport()
+
+// Transport keeps idle keep-alive connections per host so later requests to
+// the same host can reuse them.
+type Transport struct {
+	// MaxIdleConns limits idle connections across all hosts.
+	MaxIdleConns int
+	// MaxIdleConnsPerHost limits idle connections kept for each host.
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost limits connections to each host, idle or in use.
+	// Requests over the limit wait for a connection. Zero means no limit.
+	MaxConnsPerHost int
+	// IdleConnTimeout is how long a connection may sit idle in the pool
+	// before it is closed. Zero means no limit.
+	IdleConnTimeout time.Duration
+	// DisableKeepAlives sends connection: close and uses each connection for
+	// a single request.
+	DisableKeepAlives bool
+
+	mu        sync.Mutex
+	connFree  *sync.Cond
+	idle      map[string][]*persistConn
+	idleCount int
+	conns     map[string]int
+}
+
+func NewTransport() *Transport {
+	t := &Transport{
+		MaxIdleConns:        DefaultMaxIdleConns,
+		MaxIdleConnsPerHost: DefaultMaxIdleConnsPerHost,
+		IdleConnTimeout:     DefaultIdleConnTimeout,
+		idle:                make(map[string][]*persistConn),
+		conns:               make(map[string]int),
+	}
+	t.connFree = sync.NewCond(&t.mu)
+	return t
+}
+
+// persistConn is a connection to host that can carry one request at a time.
+type persistConn struct {
+	host string
+	conn net.Conn
+	br   *bufio.Reader
+	bw   *bufio.Writer
+	rr   *response.Reader
+
+	// While idle, a background read watches for the server closing the
+	// connection and reports its result on peeked.
+	idleTimer *time.Timer
+	peeked    chan error
+}
+
+// CloseIdleConnections closes every connection sitting in the pool.
+func (t *Transport) CloseIdleConnections() {
+	t.mu.Lock()
+	var idle []*persistConn
+	for host, pcs := range t.idle {
+		idle = append(idle, pcs...)
+		delete(t.idle, host)
+	}
+	t.idleCount = 0
+	t.mu.Unlock()
+	for _, pc := range idle {
+		pc.idleTimer.Stop()
+		t.closeConn(pc)
+	}
+}
+
+func (t *Transport) roundTrip(req *Request, timeout time.Duration) (*Response, error) {
+	for {
+		pc, reused, err := t.getConn(req.Host, timeout)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := t.send(pc, req, timeout)
+		if err == nil {
+			return resp, nil
+		}
+		t.closeConn(pc)
+		// The server may have closed a pooled connection just as it was
+		// reused, in which case the request never got to it
+		if reused && isStale(err) && canRetry(req) {
+			continue
+		}
+		return nil, err
+	}
+}
+
+func (t *Transport) send(pc *persistConn, req *Request, timeout time.Duration) (*Response, error) {
+	if timeout > 0 {
+		pc.conn.SetDeadline(time.Now().Add(timeout))
+	}
+	if err := writeRequest(pc.bw, req, !t.DisableKeepAlives); err != nil {
+		return nil, err
+	}
+	if err := pc.bw.Flush(); err != nil {
+		return nil, err
+	}
+	parsed, err := pc.rr.ReadResponse(req.Method)
+	if err != nil {
+		return nil, err
+	}
+	keepAlive := !parsed.Close && !t.DisableKeepAlives
+	if req.Headers != nil && req.Headers.HasToken("connection", "close") {
+		keepAlive = false
+	}
+	resp := newResponse(parsed)
+	resp.Body = &body{r: parsed.BodyReader, pc: pc, t: t, keepAlive: keepAlive}
+	return resp, nil
+}
+
+// getConn returns an idle connection to host if there is a live one, or dials
+// a new one once host is under MaxConnsPerHost.
+func (t *Transport) getConn(host string, timeout time.Duration) (*persistConn, bool, error) {
+	for {
+		t.mu.Lock()
+		pc := t.popIdle(host)
+		for pc == nil && t.MaxConnsPerHost > 0 && t.conns[host] >= t.MaxConnsPerHost {
+			t.connFree.Wait()
+			pc = t.popIdle(host)
+		}
+		if pc == nil {
+			t.conns[host]++
+		}
+		t.mu.Unlock()
+
+		if pc == nil {
+			conn, err := net.DialTimeout("tcp", host, timeout)
+			if err != nil {
+				t.mu.Lock()
+				t.conns[host]--
+				t.connFree.Broadcast()
+				t.mu.Unlock()
+				return nil, false, err
+			}
+			br := bufio.NewReader(conn)
+			return &persistConn{
+				host: host,
+				conn: conn,
+				br:   br,
+				bw:   bufio.NewWriter(conn),
+				rr:   response.NewReader(br),
+			}, false, nil
+		}
+
+		// Stop the background read. Anything but the timeout we cause means
+		// the server closed the connection or sent something unexpected.
+		pc.conn.SetReadDeadline(time.Unix(1, 0))
+		err := <-pc.peeked
+		pc.conn.SetReadDeadline(time.Time{})
+		if isTimeout(err) {
+			return pc, true, nil
+		}
+		t.closeConn(pc)
+	}
+}
+
+// popIdle takes the most recently used idle connection to host. t.mu must be
+// held.
+func (t *Transport) popIdle(host string) *persistConn {
+	pcs := t.idle[host]
+	if len(pcs) == 0 {
+		return nil
+	}
+	pc := pcs[len(pcs)-1]
+	t.idle[host] = pcs[:len(pcs)-1]
+	t.idleCount--
+	pc.idleTimer.Stop()
+	return pc
+}
+
+// putIdle returns pc to the pool, or closes it if the pool is full.
+func (t *Transport) putIdle(pc *persistConn) {
+	pc.conn.SetDeadline(time.Time{})
+	t.mu.Lock()
+	if len(t.idle[pc.host]) >= t.MaxIdleConnsPerHost || t.idleCount >= t.MaxIdleConns {
+		t.mu.Unlock()
+		t.closeConn(pc)
+		return
+	}
+	pc.peeked = make(chan error, 1)
+	pc.idleTimer = time.AfterFunc(t.idleTimeout(), func() { t.removeIdle(pc) })
+	t.idle[pc.host] = append(t.idle[pc.host], pc)
+	t.idleCount++
+	t.connFree.Broadcast()
+	t.mu.Unlock()
+
+	go func() {
+		_, err := pc.br.Peek(1)
+		pc.peeked <- err
+		if !isTimeout(err) {
+			t.removeIdle(pc)
+		}
+	}()
+}
+
+func (t *Transport) idleTimeout() time.Duration {
+	if t.IdleConnTimeout <= 0 {
+		return time.Duration(1<<63 - 1)
+	}
+	return t.IdleConnTimeout
+}
+
+// removeIdle closes pc if it is still in the pool.
+func (t *Transport) removeIdle(pc *persistConn) {
+	t.mu.Lock()
+	pcs := t.idle[pc.host]
+	for i, idle := range pcs {
+		if idle == pc {
+			t.idle[pc.host] = append(pcs[:i], pcs[i+1:]...)
+			t.idleCount--
+			t.mu.Unlock()
+			t.closeConn(pc)
+			return
+		}
+	}
+	t.mu.Unlock()
+}
+
+func (t *Transport) closeConn(pc *persistConn) {
+	pc.conn.Close()
+	t.mu.Lock()
+	t.conns[pc.host]--
+	t.connFree.Broadcast()
+	t.mu.Unlock()
+}
+
+// isStale reports whether err means the connection was closed before the
+// server read the request.
+func isStale(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// canRetry reports whether req can safely be sent again. Bodies can't be
+// replayed, so only idempotent requests without one are retried.
+func canRetry(req *Request) bool {
+	if req.Body != nil {
+		return false
+	}
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+var errBodyClosed = errors.New("read on closed response body")
+
+// body hands the connection back to the pool once the response has been read
+// to the end, or closes it.
+type body struct {
+	r         io.ReadCloser
+	pc        *persistConn
+	t         *Transport
+	keepAlive bool
+	err       error
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	n, err := b.r.Read(p)
+	if err != nil {
+		b.err = err
+		b.release(err == io.EOF)
+	}
+	return n, err
+}
+
+// Close discards what is left of a short body so the connection can be
+// reused, and closes the connection otherwise.
+func (b *body) Close() error {
+	if b.err != nil {
+		b.err = errBodyClosed
+		return nil
+	}
+	b.err = errBodyClosed
+	if !b.keepAlive {
+		b.release(false)
+		return nil
+	}
+	b.release(b.r.Close() == nil)
+	return nil
+}
+
+func (b *body) release(complete bool) {
+	if complete && b.keepAlive {
+		b.t.putIdle(b.pc)
+	} else {
+		b.t.closeConn(b.pc)
+	}
+}
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"http/internal/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, c *Client, url string) string {
+	resp, err := c.Get(url)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return string(body)
+}
+
+func poolState(tr *Transport, host string) (idle, conns int) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return len(tr.idle[host]), tr.conns[host]
+}
+
+func TestTransportReuse(t *testing.T) {
+	url := startServer(t, echo)
+	host := strings.TrimPrefix(url, "http://")
+	tr := NewTransport()
+	c := &Client{Transport: tr}
+
+	assert.Empty(t, get(t, c, url+"/one"))
+	idle, conns := poolState(tr, host)
+	assert.Equal(t, 1, idle)
+	assert.Equal(t, 1, conns)
+
+	assert.Empty(t, get(t, c, url+"/two"))
+	idle, conns = poolState(tr, host)
+	assert.Equal(t, 1, idle)
+	assert.Equal(t, 1, conns)
+
+	// Closing an unread short body drains it and keeps the connection
+	resp, err := c.Post(url+"/echo", "text/plain", strings.NewReader("unread"))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	idle, conns = poolState(tr, host)
+	assert.Equal(t, 1, idle)
+	assert.Equal(t, 1, conns)
+
+	tr.CloseIdleConnections()
+	idle, conns = poolState(tr, host)
+	assert.Equal(t, 0, idle)
+	assert.Equal(t, 0, conns)
+
+	tr.DisableKeepAlives = true
+	assert.Empty(t, get(t, c, url+"/three"))
+	idle, conns = poolState(tr, host)
+	assert.Equal(t, 0, idle)
+	assert.Equal(t, 0, conns)
+}
+
+func TestTransportLimits(t *testing.T) {
+	url := startServer(t, echo)
+	host := strings.TrimPrefix(url, "http://")
+	tr := NewTransport()
+	tr.MaxIdleConnsPerHost = 1
+	tr.MaxConnsPerHost = 2
+	c := &Client{Transport: tr}
+
+	first, err := c.Get(url)
+	require.NoError(t, err)
+	second, err := c.Get(url)
+	require.NoError(t, err)
+	_, conns := poolState(tr, host)
+	assert.Equal(t, 2, conns)
+
+	// A third request waits until one of the connections is free
+	done := make(chan string)
+	go func() {
+		resp, err := c.Get(url + "/third")
+		if err != nil {
+			done <- err.Error()
+			return
+		}
+		resp.Body.Close()
+		done <- resp.Status
+	}()
+	select {
+	case <-done:
+		t.Fatal("request over MaxConnsPerHost did not wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	io.ReadAll(first.Body)
+	first.Body.Close()
+	assert.Equal(t, "OK", <-done)
+
+	io.ReadAll(second.Body)
+	second.Body.Close()
+	idle, conns := poolState(tr, host)
+	assert.Equal(t, 1, idle)
+	assert.Equal(t, 1, conns)
+
+	tr.IdleConnTimeout = 20 * time.Millisecond
+	get(t, c, url)
+	time.Sleep(100 * time.Millisecond)
+	idle, conns = poolState(tr, host)
+	assert.Equal(t, 0, idle)
+	assert.Equal(t, 0, conns)
+}
+
+func TestTransportServerClosed(t *testing.T) {
+	url := startServer(t, echo, server.WithIdleTimeout(20*time.Millisecond))
+	host := strings.TrimPrefix(url, "http://")
+	tr := NewTransport()
+	c := &Client{Transport: tr}
+
+	get(t, c, url)
+	time.Sleep(100 * time.Millisecond)
+	idle, conns := poolState(tr, host)
+	assert.Equal(t, 0, idle)
+	assert.Equal(t, 0, conns)
+	get(t, c, url)
+}
+
+// closingServer answers one request on each connection, then reads the next
+// one and closes the connection without answering, as if it had timed out
+// the connection just as the request arrived.
+func closingServer(t *testing.T) (string, *atomic.Int32) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for i := 0; i < 2; i++ {
+					for {
+						line, err := r.ReadString('\n')
+						if err != nil {
+							return
+						}
+						if line == "\r\n" {
+							break
+						}
+					}
+					if i == 0 {
+						io.WriteString(conn, "HTTP/1.1 200 OK\r\ncontent-length: 2\r\n\r\nok")
+					}
+				}
+			}()
+		}
+	}()
+	return fmt.Sprintf("http://%s", l.Addr()), &accepted
+}
+
+func TestTransportStaleRetry(t *testing.T) {
+	url, accepted := closingServer(t)
+	c := &Client{Transport: NewTransport()}
+
+	assert.Equal(t, "ok", get(t, c, url))
+	assert.Equal(t, "ok", get(t, c, url))
+	assert.Equal(t, int32(2), accepted.Load())
+
+	// A request with a body can't be replayed
+	_, err := c.Post(url, "text/plain", strings.NewReader("x"))
+	assert.True(t, isStale(err))
+	assert.Equal(t, int32(2), accepted.Load())
+}
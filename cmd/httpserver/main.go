@@ -1,19 +1,24 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"crypto/sha256"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
+	"http/internal/fileserver"
 	"http/internal/headers"
+	"http/internal/middleware"
 	"http/internal/request"
 	"http/internal/response"
+	"http/internal/router"
 	"http/internal/server"
 )
 
@@ -21,6 +26,9 @@ const (
 	port    = 42069
 	httpbin = "/httpbin/"
 	video   = "/video"
+	assets  = "/assets"
+
+	shutdownTimeout = 30 * time.Second
 )
 
 const (
@@ -56,54 +64,56 @@ const (
 )
 
 func main() {
+	r := router.New()
+	r.Get("/httpbin/{path...}", handleHTTPBin)
+	r.Get(video, server.HandleErrors(handleVideo))
+	r.Get(assets+"/{path...}", fileserver.New("assets", fileserver.WithDirectoryListing(), fileserver.WithStripPrefix(assets)))
+	r.Get("/yourproblem", htmlHandler(response.StatusCode400, html400))
+	r.Get("/myproblem", htmlHandler(response.StatusCode500, html500))
+	r.NotFound(htmlHandler(response.StatusCode200, html200))
+
+	logger := log.Default()
+	handler := server.Chain(
+		middleware.Recover(logger),
+		middleware.RequestID(),
+		middleware.Logger(logger),
+		middleware.Timing(),
+		middleware.Conditional(),
+		middleware.Compress(),
+	)(r.Handler())
+
 	server, err := server.Serve(port, handler)
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer server.Close()
 	log.Println("Server started on port", port)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
-	log.Println("Server gracefully stopped")
-}
 
-func handler(w *response.Writer, req *request.Request) {
-	if strings.HasPrefix(req.RequestLine.RequestTarget, httpbin) {
-		handleHTTPBin(w, req)
-		return
-	} else if strings.HasPrefix(req.RequestLine.RequestTarget, video) {
-		handleVideo(w)
-		return
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
 	}
+	log.Println("Server gracefully stopped")
+}
 
-	h := headers.Headers{
-		"content-type": "text/plain",
-		"connection":   "close",
+func htmlHandler(statusCode response.StatusCode, msg string) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		w.Header().Set("content-type", "text/plain")
+		w.WriteHeader(statusCode)
+		w.Write([]byte(msg))
 	}
-	var msg string
-	var statusCode response.StatusCode
-
-	if req.RequestLine.RequestTarget == "/yourproblem" {
-		statusCode = response.StatusCode400
-		msg = html400
-	} else if req.RequestLine.RequestTarget == "/myproblem" {
-		statusCode = response.StatusCode500
-		msg = html500
-	} else {
-		statusCode = response.StatusCode200
-		msg = html200
-	}
-	w.WriteStatusLine(statusCode)
-	h["content-length"] = fmt.Sprintf("%d", len(msg))
-	w.WriteHeaders(h)
-	w.WriteBody([]byte(msg))
 }
 
 func handleHTTPBin(w *response.Writer, req *request.Request) {
-	targetSuffix := strings.TrimPrefix(req.RequestLine.RequestTarget, httpbin)
-	targetURL := fmt.Sprintf("https://httpbin.org/%s", targetSuffix)
+	target := req.RequestLine.Target
+	targetURL := fmt.Sprintf("https://httpbin.org/%s", strings.TrimPrefix(target.RawPath, httpbin))
+	if target.RawQuery != "" {
+		targetURL += "?" + target.RawQuery
+	}
 	resp, err := http.Get(targetURL)
 	if err != nil {
 		fmt.Printf("Error making HTTP request: %v\n", err)
@@ -113,71 +123,39 @@ func handleHTTPBin(w *response.Writer, req *request.Request) {
 	}
 	defer resp.Body.Close()
 	w.WriteStatusLine(response.StatusCode200)
-	h := headers.Headers{
-		"content-type":      "text/plain",
-		"connection":        "close",
-		"transfer-encoding": "chunked",
-	}
+	h := headers.NewHeaders()
+	h.Set("content-type", "text/plain")
+	h.Set("transfer-encoding", "chunked")
+	h.Set("trailer", "x-content-sha256, x-content-length")
 	w.WriteHeaders(h)
-	fullResp := make([]byte, 1024*128)
+
+	body := w.ChunkedBody()
+	hash := sha256.New()
+	out := io.MultiWriter(body, hash)
 	buf := make([]byte, 1024)
+	var n int
 	for {
-		n, err := resp.Body.Read(buf)
-		fmt.Printf("Read %d bytes from response body\n", n)
-		if err != nil && err.Error() != "EOF" {
-			fmt.Printf("Error reading response body: %v\n", err)
-			break
+		read, err := resp.Body.Read(buf)
+		if read > 0 {
+			out.Write(buf[:read])
+			// Pass each piece on as soon as httpbin sends it
+			body.Flush()
+			n += read
 		}
-		var b bytes.Buffer
-		chunk := string(buf[:n])
-
-		// Write trailers when last line has been read.
-		if n == 0 || err != nil && err.Error() == "EOF" {
-			fmt.Fprintf(&b, "0\r\n")
-			hash := sha256.Sum256(fullResp)
-			t := headers.Headers{
-				"x-content-sha256": fmt.Sprintf("%x", hash),
-				"x-content-length": fmt.Sprintf("%d", len(fullResp)),
-			}
-			w.WriteTrailers(t)
+		if err == io.EOF {
 			break
 		}
-
-		copy(fullResp[len(fullResp):], buf[:n])
-		fmt.Fprintf(&b, "%x\r\n%s\r\n", n, chunk)
-		encodedBytes := b.Bytes()
-		w.WriteChunkedBody(encodedBytes)
+		if err != nil {
+			fmt.Printf("Error reading response body: %v\n", err)
+			return
+		}
 	}
-	w.WriteChunkedBodyDone()
+	t := headers.NewHeaders()
+	t.Set("x-content-sha256", fmt.Sprintf("%x", hash.Sum(nil)))
+	t.Set("x-content-length", fmt.Sprintf("%d", n))
+	body.CloseWithTrailers(t)
 }
 
-func handleVideo(w *response.Writer) {
-	videoData, err := os.ReadFile("assets/vim.mp4")
-	if err != nil {
-		log.Printf("Error reading video file: %v\n", err)
-		w.WriteStatusLine(response.StatusCode500)
-		h := headers.NewHeaders()
-		h["content-type"] = "text/plain"
-		h["connection"] = "close"
-		errMsg := "Failed to read video file"
-		h["content-length"] = fmt.Sprintf("%d", len(errMsg))
-		w.WriteHeaders(h)
-		w.WriteBody([]byte(errMsg))
-		return
-	}
-
-	fmt.Printf("Serving video file, size: %d bytes\n", len(videoData))
-
-	if err := w.WriteStatusLine(response.StatusCode200); err != nil {
-		log.Printf("Error writing status line: %v\n", err)
-		return
-	}
-
-	h := headers.NewHeaders()
-	h["content-type"] = "video/mp4"
-	h["connection"] = "close"
-	h["content-length"] = fmt.Sprintf("%d", len(videoData))
-	w.WriteHeaders(h)
-	w.WriteBody(videoData)
-	log.Println("Video served successfully")
+func handleVideo(w *response.Writer, req *request.Request) error {
+	return fileserver.ServeFile(w, req, "assets/vim.mp4")
 }
@@ -31,8 +31,8 @@ func main() {
 		fmt.Printf("Request target: %s\n", requestLine.RequestLine.RequestTarget)
 		fmt.Printf("HTTP version: %s\n", requestLine.RequestLine.HttpVersion)
 		fmt.Printf("Headers:\n")
-		for k, v := range requestLine.Headers {
-			fmt.Printf("%s: %s\n", k, v)
+		for _, f := range requestLine.Headers.Fields() {
+			fmt.Printf("%s: %s\n", f.Name, f.Value)
 		}
 		fmt.Printf("Body:\n%s\n", string(requestLine.Body))
 	}
@@ -0,0 +1,236 @@
+package fileserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"http/internal/headers"
+	"http/internal/request"
+	"http/internal/response"
+	"http/internal/server"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type byteRange struct {
+	start, length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// ServeContent writes content as the response, answering conditional requests
+// with 304 or 412 and range requests with 206 Partial Content. name is used to
+// pick a content type when the handler hasn't set one. modtime, if not zero,
+// is sent as last-modified and used to make an etag unless the handler set
+// one on w.Header beforehand.
+func ServeContent(w *response.Writer, req *request.Request, name string, modtime time.Time, content io.ReadSeeker) error {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	contentType, ok := w.Header().Get("content-type")
+	if !ok {
+		if contentType, err = detectContentType(content, name); err != nil {
+			return err
+		}
+		w.Header().Set("content-type", contentType)
+	}
+	if !modtime.IsZero() {
+		w.Header().Set("last-modified", modtime.UTC().Format(response.TimeFormat))
+		if !w.Header().Has("etag") {
+			w.Header().Set("etag", response.FileETag(size, modtime))
+		}
+	}
+	w.Header().Set("accept-ranges", "bytes")
+
+	etag, _ := w.Header().Get("etag")
+	switch response.CheckPreconditions(req.Headers, req.RequestLine.Method, etag, modtime) {
+	case response.StatusCode304:
+		return w.NotModified()
+	case response.StatusCode412:
+		return errPreconditionFailed
+	}
+
+	rangeVal, ok := req.Headers.Get("range")
+	if !ok || req.RequestLine.Method != "GET" || !ifRangeMatches(w, req, modtime) {
+		return serveRange(w, req, content, byteRange{0, size}, response.StatusCode200)
+	}
+	ranges, err := parseRange(rangeVal, size)
+	if err != nil {
+		h := headers.NewHeaders()
+		h.Set("content-range", fmt.Sprintf("bytes */%d", size))
+		return &server.HandlerError{StatusCode: errUnsatisfiable.StatusCode, Message: errUnsatisfiable.Message, Header: h}
+	}
+	switch {
+	case ranges == nil:
+		return serveRange(w, req, content, byteRange{0, size}, response.StatusCode200)
+	case len(ranges) == 1:
+		w.Header().Set("content-range", ranges[0].contentRange(size))
+		return serveRange(w, req, content, ranges[0], response.StatusCode206)
+	default:
+		return serveMultipart(w, req, content, ranges, size, contentType)
+	}
+}
+
+func serveRange(w *response.Writer, req *request.Request, content io.ReadSeeker, r byteRange, statusCode response.StatusCode) error {
+	w.Header().Set("content-length", strconv.FormatInt(r.length, 10))
+	if err := w.WriteHeader(statusCode); err != nil {
+		return err
+	}
+	// The body of a HEAD response is dropped, so don't read it
+	if req.RequestLine.Method == "HEAD" {
+		return nil
+	}
+	if _, err := content.Seek(r.start, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.CopyN(w, content, r.length)
+	return err
+}
+
+// serveMultipart sends each range as a part of a multipart/byteranges body.
+func serveMultipart(w *response.Writer, req *request.Request, content io.ReadSeeker, ranges []byteRange, size int64, contentType string) error {
+	boundary := newBoundary()
+	partHeaders := make([]string, len(ranges))
+	length := int64(0)
+	for i, r := range ranges {
+		partHeaders[i] = fmt.Sprintf("--%s\r\ncontent-type: %s\r\ncontent-range: %s\r\n\r\n", boundary, contentType, r.contentRange(size))
+		length += int64(len(partHeaders[i])) + r.length + 2
+	}
+	closing := fmt.Sprintf("--%s--\r\n", boundary)
+	length += int64(len(closing))
+
+	w.Header().Set("content-type", "multipart/byteranges; boundary="+boundary)
+	w.Header().Set("content-length", strconv.FormatInt(length, 10))
+	if err := w.WriteHeader(response.StatusCode206); err != nil {
+		return err
+	}
+	if req.RequestLine.Method == "HEAD" {
+		return nil
+	}
+	for i, r := range ranges {
+		if _, err := content.Seek(r.start, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, partHeaders[i]); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(w, content, r.length); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "\r\n"); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, closing)
+	return err
+}
+
+// ifRangeMatches reports whether a range request should be honoured: either
+// there is no if-range, or it names the current version of the content.
+// Only strong validators count, so weak etags never match.
+func ifRangeMatches(w *response.Writer, req *request.Request, modtime time.Time) bool {
+	ifRange, ok := req.Headers.Get("if-range")
+	if !ok {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		etag, ok := w.Header().Get("etag")
+		return ok && etag == ifRange && !strings.HasPrefix(etag, "W/")
+	}
+	t, err := response.ParseTime(ifRange)
+	return err == nil && !modtime.IsZero() && t.Equal(modtime.UTC().Truncate(time.Second))
+}
+
+var errPreconditionFailed = &server.HandlerError{
+	StatusCode: response.StatusCode412,
+	Message:    "Precondition Failed",
+}
+
+var errUnsatisfiable = &server.HandlerError{
+	StatusCode: response.StatusCode416,
+	Message:    "Range Not Satisfiable",
+}
+
+// maxRanges caps how many ranges are served in one response.
+const maxRanges = 100
+
+// parseRange parses a range header against content of the given size. It
+// returns nil if the header should be ignored, as with a malformed header or
+// one asking for more than the whole content, and errUnsatisfiable if none of
+// the ranges overlap the content.
+func parseRange(s string, size int64) ([]byteRange, error) {
+	specs, ok := strings.CutPrefix(s, "bytes=")
+	if !ok {
+		return nil, nil
+	}
+	var ranges []byteRange
+	total, parsed := int64(0), 0
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		parsed++
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, nil
+		}
+		var r byteRange
+		if first == "" {
+			// A suffix range asks for the last n bytes
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, nil
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			n = min(n, size)
+			r = byteRange{size - n, n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, nil
+			}
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, nil
+				}
+				end = min(end, size-1)
+			}
+			if start >= size {
+				continue
+			}
+			r = byteRange{start, end - start + 1}
+		}
+		ranges = append(ranges, r)
+		total += r.length
+	}
+	if parsed == 0 {
+		return nil, nil
+	}
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiable
+	}
+	// Overlapping or excessive ranges cost more than sending everything
+	if len(ranges) > maxRanges || total > size {
+		return nil, nil
+	}
+	return ranges, nil
+}
+
+func newBoundary() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
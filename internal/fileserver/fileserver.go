@@ -0,0 +1,186 @@
+package fileserver
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"http/internal/request"
+	"http/internal/response"
+	"http/internal/server"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+const indexPage = "index.html"
+
+type fileServer struct {
+	root        string
+	listDirs    bool
+	stripPrefix string
+}
+
+type Option func(*fileServer)
+
+// WithDirectoryListing renders an HTML listing for directories without an
+// index.html instead of answering 404.
+func WithDirectoryListing() Option {
+	return func(fsrv *fileServer) {
+		fsrv.listDirs = true
+	}
+}
+
+// WithStripPrefix removes prefix from the request path before looking it up
+// under the root, for serving a directory under a route like /static/.
+func WithStripPrefix(prefix string) Option {
+	return func(fsrv *fileServer) {
+		fsrv.stripPrefix = strings.TrimSuffix(prefix, "/")
+	}
+}
+
+// New returns a handler serving the files under root by request path.
+// Directories are served through their index.html. Paths can't reach outside
+// root, whether through .. segments or symlinks.
+func New(root string, opts ...Option) server.Handler {
+	fsrv := &fileServer{root: root}
+	for _, opt := range opts {
+		opt(fsrv)
+	}
+	return server.HandleErrors(fsrv.serve)
+}
+
+// ServeFile streams the file at name as the response.
+func ServeFile(w *response.Writer, req *request.Request, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return openError(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return notFound
+	}
+	return ServeContent(w, req, info.Name(), info.ModTime(), f)
+}
+
+func (fsrv *fileServer) serve(w *response.Writer, req *request.Request) error {
+	p, ok := strings.CutPrefix(req.RequestLine.Target.Path, fsrv.stripPrefix)
+	if !ok || (p != "" && !strings.HasPrefix(p, "/")) {
+		return notFound
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if segment == ".." || strings.ContainsAny(segment, "\\\x00") {
+			return &server.HandlerError{StatusCode: response.StatusCode400, Message: "invalid path"}
+		}
+	}
+
+	// os.Root refuses to follow anything, symlinks included, out of root
+	root, err := os.OpenRoot(fsrv.root)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	name := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if name == "" {
+		name = "."
+	}
+	f, err := root.Open(name)
+	if err != nil {
+		return openError(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		if strings.HasSuffix(p, "/") {
+			return notFound
+		}
+		return ServeContent(w, req, info.Name(), info.ModTime(), f)
+	}
+
+	// Relative links in the page only resolve against a path ending in /
+	if !strings.HasSuffix(p, "/") {
+		// The full path is used since p is empty for the bare prefix
+		target := req.RequestLine.Target
+		location := (&url.URL{Path: path.Base(target.Path) + "/"}).String()
+		if target.RawQuery != "" {
+			location += "?" + target.RawQuery
+		}
+		return redirect(w, location)
+	}
+	index, err := root.Open(path.Join(name, indexPage))
+	if err == nil {
+		defer index.Close()
+		if indexInfo, err := index.Stat(); err == nil && !indexInfo.IsDir() {
+			return ServeContent(w, req, indexInfo.Name(), indexInfo.ModTime(), index)
+		}
+	}
+	if !fsrv.listDirs {
+		return notFound
+	}
+	return listDir(w, f, p)
+}
+
+func listDir(w *response.Writer, dir *os.File, p string) error {
+	entries, err := dir.ReadDir(-1)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var b strings.Builder
+	title := html.EscapeString("Index of " + p)
+	fmt.Fprintf(&b, "<html>\n  <head>\n    <title>%s</title>\n  </head>\n  <body>\n    <h1>%s</h1>\n    <ul>\n", title, title)
+	for _, name := range names {
+		// String adds ./ when the name could be read as a scheme
+		href := (&url.URL{Path: name}).String()
+		fmt.Fprintf(&b, "      <li><a href=\"%s\">%s</a></li>\n", html.EscapeString(href), html.EscapeString(name))
+	}
+	b.WriteString("    </ul>\n  </body>\n</html>\n")
+
+	w.Header().Set("content-type", "text/html; charset=utf-8")
+	if err := w.WriteHeader(response.StatusCode200); err != nil {
+		return err
+	}
+	_, err = w.Write([]byte(b.String()))
+	return err
+}
+
+func redirect(w *response.Writer, location string) error {
+	w.Header().Set("location", location)
+	return w.WriteHeader(response.StatusCode301)
+}
+
+var notFound = &server.HandlerError{StatusCode: response.StatusCode404, Message: "Not Found"}
+
+func openError(err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return notFound
+	case errors.Is(err, fs.ErrPermission):
+		return &server.HandlerError{StatusCode: response.StatusCode403, Message: "Forbidden"}
+	}
+	// Escaping the root or walking through a file are lookups of paths
+	// that don't exist as far as the client is concerned
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return notFound
+	}
+	return err
+}
@@ -0,0 +1,303 @@
+package fileserver
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"http/internal/headers"
+	"http/internal/request"
+	"http/internal/response"
+	"http/internal/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serve runs h for a GET of target with the given header lines.
+func serve(t *testing.T, h server.Handler, target string, fields ...string) *response.Response {
+	raw := "GET " + target + " HTTP/1.1\r\n"
+	for _, field := range fields {
+		raw += field + "\r\n"
+	}
+	req, err := request.RequestFromReader(strings.NewReader(raw + "\r\n"))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	w := response.NewWriter(&buf)
+	h(w, req)
+	require.NoError(t, w.Finish())
+	resp, err := response.ResponseFromReader(&buf)
+	require.NoError(t, err)
+	return resp
+}
+
+func get(h *headers.Headers, key string) string {
+	val, _ := h.Get(key)
+	return val
+}
+
+func writeFile(t *testing.T, name string, data []byte) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(name), 0o755))
+	require.NoError(t, os.WriteFile(name, data, 0o644))
+}
+
+func TestServeFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "hello.txt"), []byte("hello world"))
+	writeFile(t, filepath.Join(root, "style.css"), []byte("body {}"))
+	writeFile(t, filepath.Join(root, "noext"), []byte("\x89PNG\r\n\x1a\nrest"))
+	writeFile(t, filepath.Join(root, "site", "index.html"), []byte("<h1>home</h1>"))
+	writeFile(t, filepath.Join(root, "a b", "c.txt"), []byte("spaces"))
+	h := New(root)
+
+	resp := serve(t, h, "/hello.txt")
+	assert.Equal(t, response.StatusCode200, resp.StatusLine.StatusCode)
+	assert.Equal(t, "text/plain; charset=utf-8", get(resp.Headers, "content-type"))
+	assert.Equal(t, "11", get(resp.Headers, "content-length"))
+	assert.Equal(t, "hello world", string(resp.Body))
+
+	resp = serve(t, h, "/style.css?v=2")
+	assert.Equal(t, "text/css; charset=utf-8", get(resp.Headers, "content-type"))
+
+	resp = serve(t, h, "/noext")
+	assert.Equal(t, "image/png", get(resp.Headers, "content-type"))
+
+	resp = serve(t, h, "/a%20b/c.txt")
+	assert.Equal(t, "spaces", string(resp.Body))
+
+	resp = serve(t, h, "/site/")
+	assert.Equal(t, "text/html; charset=utf-8", get(resp.Headers, "content-type"))
+	assert.Equal(t, "<h1>home</h1>", string(resp.Body))
+
+	resp = serve(t, h, "/site")
+	assert.Equal(t, response.StatusCode301, resp.StatusLine.StatusCode)
+	assert.Equal(t, "site/", get(resp.Headers, "location"))
+
+	resp = serve(t, h, "/missing.txt")
+	assert.Equal(t, response.StatusCode404, resp.StatusLine.StatusCode)
+	resp = serve(t, h, "/hello.txt/")
+	assert.Equal(t, response.StatusCode404, resp.StatusLine.StatusCode)
+
+	// Directories without an index aren't listed unless asked for
+	resp = serve(t, h, "/")
+	assert.Equal(t, response.StatusCode404, resp.StatusLine.StatusCode)
+}
+
+func TestPathTraversal(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "public")
+	writeFile(t, filepath.Join(root, "ok.txt"), []byte("ok"))
+	writeFile(t, filepath.Join(dir, "secret.txt"), []byte("secret"))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(root, "link.txt")))
+	h := New(root)
+
+	for _, target := range []string{"/../secret.txt", "/%2e%2e/secret.txt", "/x/../../secret.txt", "/..%2fsecret.txt", "/%5c..%5csecret.txt"} {
+		resp := serve(t, h, target)
+		assert.Equal(t, response.StatusCode400, resp.StatusLine.StatusCode, target)
+		assert.NotContains(t, string(resp.Body), "secret")
+	}
+	resp := serve(t, h, "/link.txt")
+	assert.Equal(t, response.StatusCode404, resp.StatusLine.StatusCode)
+	assert.NotContains(t, string(resp.Body), "secret")
+}
+
+func TestDirectoryListing(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "static", "b.txt"), nil)
+	writeFile(t, filepath.Join(root, "static", "<a>.txt"), nil)
+	writeFile(t, filepath.Join(root, "static", "sub", "c.txt"), nil)
+	writeFile(t, filepath.Join(root, "static", "javascript:alert(1)"), nil)
+	h := New(root, WithDirectoryListing(), WithStripPrefix("/files/"))
+
+	resp := serve(t, h, "/files/static/")
+	assert.Equal(t, response.StatusCode200, resp.StatusLine.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", get(resp.Headers, "content-type"))
+	body := string(resp.Body)
+	assert.Contains(t, body, "<title>Index of /static/</title>")
+	assert.Contains(t, body, `<li><a href="%3Ca%3E.txt">&lt;a&gt;.txt</a></li>`)
+	assert.Contains(t, body, `<li><a href="b.txt">b.txt</a></li>`)
+	assert.Contains(t, body, `<li><a href="sub/">sub/</a></li>`)
+	assert.Contains(t, body, `<li><a href="./javascript:alert%281%29">javascript:alert(1)</a></li>`)
+
+	resp = serve(t, h, "/files/static/sub/c.txt")
+	assert.Equal(t, response.StatusCode200, resp.StatusLine.StatusCode)
+	resp = serve(t, h, "/other/static/")
+	assert.Equal(t, response.StatusCode404, resp.StatusLine.StatusCode)
+	resp = serve(t, h, "/filesx/static/")
+	assert.Equal(t, response.StatusCode404, resp.StatusLine.StatusCode)
+
+	resp = serve(t, h, "/files")
+	assert.Equal(t, response.StatusCode301, resp.StatusLine.StatusCode)
+	assert.Equal(t, "files/", get(resp.Headers, "location"))
+	resp = serve(t, h, "/files/static?sort=name")
+	assert.Equal(t, response.StatusCode301, resp.StatusLine.StatusCode)
+	assert.Equal(t, "static/?sort=name", get(resp.Headers, "location"))
+}
+
+func TestSniff(t *testing.T) {
+	assert.Equal(t, "text/html; charset=utf-8", sniff([]byte("\n  <!DOCTYPE html><html>")))
+	assert.Equal(t, "video/mp4", sniff([]byte("\x00\x00\x00\x18ftypmp42")))
+	assert.Equal(t, "text/plain; charset=utf-8", sniff([]byte("héllo\n")))
+	assert.Equal(t, "text/plain; charset=utf-8", sniff([]byte("cut off \xc3")))
+	assert.Equal(t, "application/octet-stream", sniff([]byte("\x00\x01\x02")))
+	assert.Equal(t, "application/octet-stream", sniff([]byte("bad \xff utf-8")))
+}
+
+func TestRanges(t *testing.T) {
+	root := t.TempDir()
+	name := filepath.Join(root, "digits.txt")
+	writeFile(t, name, []byte("0123456789"))
+	modtime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(name, modtime, modtime))
+	h := New(root)
+
+	resp := serve(t, h, "/digits.txt")
+	assert.Equal(t, response.StatusCode200, resp.StatusLine.StatusCode)
+	assert.Equal(t, "bytes", get(resp.Headers, "accept-ranges"))
+	assert.Equal(t, "Fri, 01 Mar 2024 12:00:00 GMT", get(resp.Headers, "last-modified"))
+
+	tests := []struct {
+		rangeVal     string
+		contentRange string
+		body         string
+	}{
+		{"bytes=2-4", "bytes 2-4/10", "234"},
+		{"bytes=7-", "bytes 7-9/10", "789"},
+		{"bytes=-3", "bytes 7-9/10", "789"},
+		{"bytes=8-100", "bytes 8-9/10", "89"},
+		{"bytes=-100", "bytes 0-9/10", "0123456789"},
+		{"bytes=20-30, 1-1", "bytes 1-1/10", "1"},
+	}
+	for _, tc := range tests {
+		resp := serve(t, h, "/digits.txt", "Range: "+tc.rangeVal)
+		assert.Equal(t, response.StatusCode206, resp.StatusLine.StatusCode, tc.rangeVal)
+		assert.Equal(t, tc.contentRange, get(resp.Headers, "content-range"), tc.rangeVal)
+		assert.Equal(t, tc.body, string(resp.Body), tc.rangeVal)
+	}
+
+	// Malformed or wasteful ranges are ignored
+	for _, rangeVal := range []string{"bytes=5-2", "bytes=x-1", "items=0-1", "bytes=", "bytes=0-9,0-9"} {
+		resp := serve(t, h, "/digits.txt", "Range: "+rangeVal)
+		assert.Equal(t, response.StatusCode200, resp.StatusLine.StatusCode, rangeVal)
+		assert.Equal(t, "0123456789", string(resp.Body), rangeVal)
+	}
+
+	for _, rangeVal := range []string{"bytes=10-", "bytes=-0", "bytes=20-30,40-"} {
+		resp := serve(t, h, "/digits.txt", "Range: "+rangeVal)
+		assert.Equal(t, response.StatusCode416, resp.StatusLine.StatusCode, rangeVal)
+		assert.Equal(t, "bytes */10", get(resp.Headers, "content-range"), rangeVal)
+	}
+
+	// If-Range only allows the range while the file is unchanged
+	resp = serve(t, h, "/digits.txt", "Range: bytes=0-1", "If-Range: Fri, 01 Mar 2024 12:00:00 GMT")
+	assert.Equal(t, response.StatusCode206, resp.StatusLine.StatusCode)
+	resp = serve(t, h, "/digits.txt", "Range: bytes=0-1", "If-Range: Thu, 29 Feb 2024 12:00:00 GMT")
+	assert.Equal(t, response.StatusCode200, resp.StatusLine.StatusCode)
+	resp = serve(t, h, "/digits.txt", "Range: bytes=0-1", `If-Range: "some-etag"`)
+	assert.Equal(t, response.StatusCode200, resp.StatusLine.StatusCode)
+}
+
+func TestMultipartRanges(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "digits.txt"), []byte("0123456789"))
+	h := New(root)
+
+	resp := serve(t, h, "/digits.txt", "Range: bytes=0-1, 5-6")
+	assert.Equal(t, response.StatusCode206, resp.StatusLine.StatusCode)
+	contentType := get(resp.Headers, "content-type")
+	boundary, ok := strings.CutPrefix(contentType, "multipart/byteranges; boundary=")
+	require.True(t, ok, contentType)
+	assert.Equal(t, fmt.Sprintf("%d", len(resp.Body)), get(resp.Headers, "content-length"))
+	assert.Equal(t, "--"+boundary+"\r\n"+
+		"content-type: text/plain; charset=utf-8\r\n"+
+		"content-range: bytes 0-1/10\r\n"+
+		"\r\n"+
+		"01\r\n"+
+		"--"+boundary+"\r\n"+
+		"content-type: text/plain; charset=utf-8\r\n"+
+		"content-range: bytes 5-6/10\r\n"+
+		"\r\n"+
+		"56\r\n"+
+		"--"+boundary+"--\r\n", string(resp.Body))
+}
+
+func TestServeContent(t *testing.T) {
+	// Any seekable body can be served with ranges
+	h := func(w *response.Writer, req *request.Request) {
+		w.Header().Set("etag", `"v1"`)
+		ServeContent(w, req, "data", time.Time{}, strings.NewReader("abcdefgh"))
+	}
+	resp := serve(t, h, "/", "Range: bytes=-2", `If-Range: "v1"`)
+	assert.Equal(t, response.StatusCode206, resp.StatusLine.StatusCode)
+	assert.Equal(t, "gh", string(resp.Body))
+	assert.Equal(t, "", get(resp.Headers, "last-modified"))
+	assert.Equal(t, "text/plain; charset=utf-8", get(resp.Headers, "content-type"))
+}
+
+// countingReader counts the bytes read from it.
+type countingReader struct {
+	*strings.Reader
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += n
+	return n, err
+}
+
+func TestServeContentHead(t *testing.T) {
+	content := &countingReader{Reader: strings.NewReader(strings.Repeat("a", 10000))}
+	req, err := request.RequestFromReader(strings.NewReader("HEAD / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	w := response.NewWriter(&buf)
+	w.SuppressBody()
+	w.Header().Set("content-type", "text/plain")
+	require.NoError(t, ServeContent(w, req, "data", time.Time{}, content))
+	require.NoError(t, w.Finish())
+
+	resp, err := response.NewReader(&buf).ReadResponse("HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCode200, resp.StatusLine.StatusCode)
+	assert.Equal(t, "10000", get(resp.Headers, "content-length"))
+	assert.Equal(t, 0, content.n)
+}
+
+func TestConditional(t *testing.T) {
+	root := t.TempDir()
+	name := filepath.Join(root, "digits.txt")
+	writeFile(t, name, []byte("0123456789"))
+	modtime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(name, modtime, modtime))
+	h := New(root)
+
+	resp := serve(t, h, "/digits.txt")
+	etag := get(resp.Headers, "etag")
+	assert.Equal(t, response.FileETag(10, modtime), etag)
+
+	resp = serve(t, h, "/digits.txt", "If-None-Match: "+etag)
+	assert.Equal(t, response.StatusCode304, resp.StatusLine.StatusCode)
+	assert.Equal(t, etag, get(resp.Headers, "etag"))
+	assert.Equal(t, "", get(resp.Headers, "content-length"))
+	assert.Empty(t, resp.Body)
+
+	resp = serve(t, h, "/digits.txt", "If-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT")
+	assert.Equal(t, response.StatusCode304, resp.StatusLine.StatusCode)
+	resp = serve(t, h, "/digits.txt", "If-Modified-Since: Thu, 29 Feb 2024 12:00:00 GMT")
+	assert.Equal(t, response.StatusCode200, resp.StatusLine.StatusCode)
+
+	resp = serve(t, h, "/digits.txt", `If-Match: "other"`)
+	assert.Equal(t, response.StatusCode412, resp.StatusLine.StatusCode)
+	resp = serve(t, h, "/digits.txt", "If-Unmodified-Since: Thu, 29 Feb 2024 12:00:00 GMT")
+	assert.Equal(t, response.StatusCode412, resp.StatusLine.StatusCode)
+
+	// A matching if-match lets the range through
+	resp = serve(t, h, "/digits.txt", "If-Match: "+etag, "Range: bytes=0-1")
+	assert.Equal(t, response.StatusCode206, resp.StatusLine.StatusCode)
+	assert.Equal(t, "01", string(resp.Body))
+}
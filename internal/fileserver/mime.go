@@ -0,0 +1,98 @@
+package fileserver
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// sniffLen is how much of a file is looked at when its extension doesn't
+// give away its type.
+const sniffLen = 512
+
+// contentTypes covers common extensions that aren't in mime's builtin table,
+// so they don't depend on the system's mime.types.
+var contentTypes = map[string]string{
+	".txt":  "text/plain; charset=utf-8",
+	".md":   "text/markdown; charset=utf-8",
+	".csv":  "text/csv; charset=utf-8",
+	".ico":  "image/vnd.microsoft.icon",
+	".mp3":  "audio/mpeg",
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+	".zip":  "application/zip",
+	".gz":   "application/gzip",
+}
+
+var signatures = []struct {
+	offset      int
+	magic       []byte
+	contentType string
+}{
+	{0, []byte("%PDF-"), "application/pdf"},
+	{0, []byte("\x89PNG\r\n\x1a\n"), "image/png"},
+	{0, []byte("\xff\xd8\xff"), "image/jpeg"},
+	{0, []byte("GIF87a"), "image/gif"},
+	{0, []byte("GIF89a"), "image/gif"},
+	{0, []byte("PK\x03\x04"), "application/zip"},
+	{0, []byte("\x1f\x8b\x08"), "application/gzip"},
+	{0, []byte("\x1a\x45\xdf\xa3"), "video/webm"},
+	{0, []byte("ID3"), "audio/mpeg"},
+	{4, []byte("ftyp"), "video/mp4"},
+}
+
+// detectContentType goes by the extension of name, falling back to sniffing
+// the start of content. content is left at its start.
+func detectContentType(content io.ReadSeeker, name string) (string, error) {
+	ext := strings.ToLower(path.Ext(name))
+	if contentType, ok := contentTypes[ext]; ok {
+		return contentType, nil
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType, nil
+	}
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(content, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return sniff(buf[:n]), nil
+}
+
+func sniff(data []byte) string {
+	for _, sig := range signatures {
+		if len(data) >= sig.offset+len(sig.magic) && bytes.Equal(data[sig.offset:sig.offset+len(sig.magic)], sig.magic) {
+			return sig.contentType
+		}
+	}
+	trimmed := bytes.ToLower(bytes.TrimLeft(data, " \t\r\n"))
+	if bytes.HasPrefix(trimmed, []byte("<!doctype html")) || bytes.HasPrefix(trimmed, []byte("<html")) {
+		return "text/html; charset=utf-8"
+	}
+	if isText(data) {
+		return "text/plain; charset=utf-8"
+	}
+	return "application/octet-stream"
+}
+
+// isText reports whether data looks like UTF-8 text. The sniffed prefix may
+// end partway through a character, which is allowed.
+func isText(data []byte) bool {
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 {
+			return !utf8.FullRune(data) && len(data) < utf8.UTFMax
+		}
+		if r < ' ' && r != '\t' && r != '\n' && r != '\r' && r != '\f' {
+			return false
+		}
+		data = data[size:]
+	}
+	return true
+}
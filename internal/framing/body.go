@@ -0,0 +1,204 @@
+package framing
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// maxDrainBytes caps how much of an unread body is discarded to keep the
+// connection usable for the next message.
+const maxDrainBytes = 256 << 10
+
+type bodyState int
+
+const (
+	stateData bodyState = iota
+	stateUntilClose
+	stateChunkSize
+	stateChunkData
+	stateChunkEnd
+	stateTrailers
+	stateDone
+)
+
+// Body streams a message body off a Conn shared with the parser of the
+// message, stopping at the end of the body so the next message can be read.
+type Body struct {
+	conn    *Conn
+	state   bodyState
+	left    int64
+	read    int64
+	chunked Chunked
+	err     error
+	closed  bool
+}
+
+// Chunked configures how a chunked body is read.
+type Chunked struct {
+	// MaxBytes caps the total size of the chunks, failing with ErrTooLarge
+	// once it is passed. Zero means no limit.
+	MaxBytes    int64
+	ErrTooLarge error
+	// ParseTrailer parses a trailer line the way headers.Headers.Parse
+	// does, letting the caller collect the fields and apply its limits.
+	ParseTrailer func(data []byte) (int, bool, error)
+}
+
+// NewLengthBody returns a body of n bytes.
+func NewLengthBody(c *Conn, n int64) *Body {
+	b := &Body{conn: c, state: stateData, left: n}
+	if n <= 0 {
+		b.state = stateDone
+	}
+	return b
+}
+
+// NewChunkedBody returns a chunked body.
+func NewChunkedBody(c *Conn, chunked Chunked) *Body {
+	return &Body{conn: c, state: stateChunkSize, chunked: chunked}
+}
+
+// NewCloseDelimitedBody returns a body that runs until the connection closes.
+func NewCloseDelimitedBody(c *Conn) *Body {
+	return &Body{conn: c, state: stateUntilClose}
+}
+
+func (b *Body) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	n, err := b.readBody(p)
+	if err != nil {
+		b.err = err
+	}
+	return n, err
+}
+
+func (b *Body) readBody(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		switch b.state {
+		case stateDone:
+			return 0, io.EOF
+		case stateData, stateChunkData, stateUntilClose:
+			if b.state != stateUntilClose {
+				p = p[:min(int64(len(p)), b.left)]
+			}
+			n, err := b.conn.Read(p)
+			if n == 0 {
+				if err == io.EOF && b.state == stateUntilClose {
+					b.state = stateDone
+					return 0, io.EOF
+				}
+				if err == io.EOF {
+					return 0, fmt.Errorf("%w while reading body", io.ErrUnexpectedEOF)
+				}
+				if err != nil {
+					return 0, err
+				}
+				continue
+			}
+			if b.state == stateUntilClose {
+				return n, nil
+			}
+			b.left -= int64(n)
+			if b.left == 0 {
+				if b.state == stateData {
+					b.state = stateDone
+				} else {
+					b.state = stateChunkEnd
+				}
+			}
+			return n, nil
+		default:
+			if err := b.conn.Next(b.parse); err != nil {
+				if err == io.EOF {
+					return 0, fmt.Errorf("%w while reading body", io.ErrUnexpectedEOF)
+				}
+				return 0, err
+			}
+		}
+	}
+}
+
+// parse handles the framing between chunks.
+func (b *Body) parse(data []byte) (int, error) {
+	switch b.state {
+	case stateChunkSize:
+		size, bytesRead, err := parseChunkSize(data)
+		if err != nil || bytesRead == 0 {
+			return 0, err
+		}
+		b.read += size
+		if b.chunked.MaxBytes > 0 && b.read > b.chunked.MaxBytes {
+			return 0, fmt.Errorf("%w: chunked body over %d bytes", b.chunked.ErrTooLarge, b.chunked.MaxBytes)
+		}
+		if size == 0 {
+			b.state = stateTrailers
+		} else {
+			b.left = size
+			b.state = stateChunkData
+		}
+		return bytesRead, nil
+	case stateChunkEnd:
+		if len(data) < len(crlf) {
+			return 0, nil
+		}
+		if !bytes.HasPrefix(data, []byte(crlf)) {
+			return 0, fmt.Errorf("%w: missing CRLF after chunk data", ErrInvalidChunk)
+		}
+		b.state = stateChunkSize
+		return len(crlf), nil
+	case stateTrailers:
+		bytesRead, done, err := b.chunked.ParseTrailer(data)
+		if err != nil {
+			return 0, err
+		}
+		if done {
+			b.state = stateDone
+		}
+		return bytesRead, nil
+	default:
+		return 0, fmt.Errorf("invalid state: %d", b.state)
+	}
+}
+
+// Drainable reports whether Close can discard the rest of the body. Bodies
+// of unknown length only count once they have been read to the end.
+func (b *Body) Drainable() bool {
+	if b.err != nil && b.err != io.EOF {
+		return false
+	}
+	switch b.state {
+	case stateDone:
+		return true
+	case stateData:
+		return b.left <= maxDrainBytes
+	default:
+		return false
+	}
+}
+
+// Close discards whatever is left of the body so the next message can be
+// read. It fails if the remainder is too large to be worth draining.
+func (b *Body) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	if b.err != nil && b.err != io.EOF {
+		return b.err
+	}
+	if _, err := io.Copy(io.Discard, io.LimitReader(b, maxDrainBytes)); err != nil {
+		return err
+	}
+	if b.state != stateDone {
+		b.err = ErrBodyNotDrained
+		return b.err
+	}
+	b.err = fmt.Errorf("read on closed body")
+	return nil
+}
@@ -0,0 +1,72 @@
+package framing
+
+import "io"
+
+// Conn buffers what is read off a connection so a parser can look at bytes
+// before deciding how many of them belong to the current message. Bytes read
+// past the end of one message are kept for the next.
+type Conn struct {
+	r       io.Reader
+	buf     []byte
+	readIdx int
+}
+
+func NewConn(r io.Reader) *Conn {
+	return &Conn{r: r, buf: make([]byte, 8)}
+}
+
+// Buffered returns the bytes read but not yet consumed.
+func (c *Conn) Buffered() []byte {
+	return c.buf[:c.readIdx]
+}
+
+// Fill reads more off the connection into the buffer, growing it if full.
+func (c *Conn) Fill() (int, error) {
+	if c.readIdx >= len(c.buf) {
+		newBuf := make([]byte, len(c.buf)*2)
+		copy(newBuf, c.buf[:c.readIdx])
+		c.buf = newBuf
+	}
+	n, err := c.r.Read(c.buf[c.readIdx:])
+	c.readIdx += n
+	return n, err
+}
+
+// Consume drops the first n buffered bytes.
+func (c *Conn) Consume(n int) {
+	copy(c.buf, c.buf[n:c.readIdx])
+	c.readIdx -= n
+}
+
+// Next hands the buffered bytes to parse, reading more off the connection
+// until parse consumes some of them. It returns io.EOF as is if the
+// connection closes first.
+func (c *Conn) Next(parse func(data []byte) (int, error)) error {
+	for {
+		consumed, err := parse(c.Buffered())
+		if err != nil {
+			return err
+		}
+		if consumed > 0 {
+			c.Consume(consumed)
+			return nil
+		}
+		n, err := c.Fill()
+		if n > 0 {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Read hands out buffered bytes first and then reads straight into p.
+func (c *Conn) Read(p []byte) (int, error) {
+	if c.readIdx > 0 {
+		n := copy(p, c.buf[:c.readIdx])
+		c.Consume(n)
+		return n, nil
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,78 @@
+// Package framing reads HTTP/1.1 message bodies for the request and response
+// parsers, which share the same content-length and chunked framing rules.
+package framing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"http/internal/headers"
+	"strconv"
+	"strings"
+)
+
+const (
+	crlf = "\r\n"
+
+	maxChunkLineBytes = 4 << 10
+)
+
+// Framing errors, wrapped with details about the offending input.
+var (
+	ErrInvalidContentLength = errors.New("invalid content-length header")
+	ErrInvalidFraming       = errors.New("conflicting message framing")
+	ErrUnsupportedEncoding  = errors.New("unsupported transfer-encoding")
+	ErrInvalidChunk         = errors.New("invalid chunk")
+	// ErrBodyNotDrained is returned by Body.Close when the rest of the body
+	// is too large to discard.
+	ErrBodyNotDrained = errors.New("unread body too large to discard")
+)
+
+// Length works out how the body of a message with headers h is delimited. It
+// reports whether the body is chunked, and otherwise returns its
+// content-length, or -1 if there is none.
+func Length(h *headers.Headers) (int64, bool, error) {
+	sizeVal, hasLength := h.Get("content-length")
+	if te, ok := h.Get("transfer-encoding"); ok {
+		if hasLength {
+			return 0, false, fmt.Errorf("%w: both content-length and transfer-encoding set", ErrInvalidFraming)
+		}
+		if !isChunked(h) {
+			return 0, false, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, te)
+		}
+		return 0, true, nil
+	}
+	if !hasLength {
+		return -1, false, nil
+	}
+	size, err := strconv.ParseInt(sizeVal, 10, 64)
+	if err != nil || size < 0 {
+		return 0, false, fmt.Errorf("%w: %s", ErrInvalidContentLength, sizeVal)
+	}
+	return size, false, nil
+}
+
+// isChunked reports whether chunked is the only transfer coding. Other
+// codings aren't supported, so a body using them can't be read.
+func isChunked(h *headers.Headers) bool {
+	val, _ := h.Get("transfer-encoding")
+	return strings.EqualFold(strings.TrimSpace(val), "chunked")
+}
+
+// parseChunkSize parses a chunk-size line, ignoring any chunk extensions.
+func parseChunkSize(data []byte) (int64, int, error) {
+	endIdx := bytes.Index(data, []byte(crlf))
+	if endIdx > maxChunkLineBytes || (endIdx == -1 && len(data) > maxChunkLineBytes) {
+		return 0, 0, fmt.Errorf("%w: chunk size line too long", ErrInvalidChunk)
+	}
+	if endIdx == -1 {
+		return 0, 0, nil
+	}
+	line := string(data[:endIdx])
+	hexStr, _, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(strings.TrimSpace(hexStr), 16, 64)
+	if err != nil || size < 0 {
+		return 0, 0, fmt.Errorf("%w: bad size %s", ErrInvalidChunk, line)
+	}
+	return size, endIdx + len(crlf), nil
+}
@@ -0,0 +1,81 @@
+package framing
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"http/internal/headers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLength(t *testing.T) {
+	tests := []struct {
+		fields  map[string]string
+		length  int64
+		chunked bool
+		err     error
+	}{
+		{nil, -1, false, nil},
+		{map[string]string{"content-length": "12"}, 12, false, nil},
+		{map[string]string{"content-length": "-1"}, 0, false, ErrInvalidContentLength},
+		{map[string]string{"content-length": "x"}, 0, false, ErrInvalidContentLength},
+		{map[string]string{"transfer-encoding": "chunked"}, 0, true, nil},
+		{map[string]string{"transfer-encoding": "chunked", "content-length": "3"}, 0, false, ErrInvalidFraming},
+		{map[string]string{"transfer-encoding": " Chunked "}, 0, true, nil},
+		{map[string]string{"transfer-encoding": "gzip"}, 0, false, ErrUnsupportedEncoding},
+		{map[string]string{"transfer-encoding": "gzip, chunked"}, 0, false, ErrUnsupportedEncoding},
+		{map[string]string{"transfer-encoding": "chunked, chunked"}, 0, false, ErrUnsupportedEncoding},
+	}
+	for _, tc := range tests {
+		h := headers.NewHeaders()
+		for k, v := range tc.fields {
+			h.Set(k, v)
+		}
+		length, chunked, err := Length(h)
+		if tc.err != nil {
+			assert.ErrorIs(t, err, tc.err, tc.fields)
+			continue
+		}
+		require.NoError(t, err, tc.fields)
+		assert.Equal(t, tc.length, length, tc.fields)
+		assert.Equal(t, tc.chunked, chunked, tc.fields)
+	}
+}
+
+func TestBody(t *testing.T) {
+	conn := NewConn(strings.NewReader("hello" + "5\r\nworld\r\n0\r\nx-sum: 1\r\n\r\n" + "rest"))
+
+	data, err := io.ReadAll(NewLengthBody(conn, 5))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	trailers := headers.NewHeaders()
+	data, err = io.ReadAll(NewChunkedBody(conn, Chunked{ParseTrailer: trailers.Parse}))
+	require.NoError(t, err)
+	assert.Equal(t, "world", string(data))
+	sum, _ := trailers.Get("x-sum")
+	assert.Equal(t, "1", sum)
+
+	data, err = io.ReadAll(NewCloseDelimitedBody(conn))
+	require.NoError(t, err)
+	assert.Equal(t, "rest", string(data))
+
+	// Chunked bodies over the limit fail with the caller's error
+	errTooLarge := errors.New("too large")
+	conn = NewConn(strings.NewReader("5\r\nhello\r\n0\r\n\r\n"))
+	_, err = io.ReadAll(NewChunkedBody(conn, Chunked{MaxBytes: 4, ErrTooLarge: errTooLarge, ParseTrailer: trailers.Parse}))
+	assert.ErrorIs(t, err, errTooLarge)
+
+	// Only bodies known to be small enough can be drained
+	assert.True(t, NewLengthBody(conn, maxDrainBytes).Drainable())
+	assert.False(t, NewLengthBody(conn, maxDrainBytes+1).Drainable())
+	assert.False(t, NewChunkedBody(conn, Chunked{ParseTrailer: trailers.Parse}).Drainable())
+
+	conn = NewConn(strings.NewReader("hel"))
+	_, err = io.ReadAll(NewLengthBody(conn, 5))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
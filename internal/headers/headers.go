@@ -2,15 +2,31 @@ package headers
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"strings"
 )
 
-type Headers map[string]string
+// Headers holds header fields in the order they were added, keeping the
+// original casing of each name. Lookups ignore case.
+type Headers struct {
+	fields []Field
+}
+
+type Field struct {
+	Name  string
+	Value string
+}
 
 const SEPARATOR = "\r\n"
 
-func (h Headers) Parse(data []byte) (n int, done bool, err error) {
+var (
+	ErrInvalidHeader  = errors.New("invalid header")
+	ErrHeaderTooLarge = errors.New("header fields too large")
+	ErrTooManyHeaders = errors.New("too many header fields")
+)
+
+func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
 	if bytes.Index(data, []byte(SEPARATOR)) == -1 {
 		return 0, false, nil
 	}
@@ -22,38 +38,120 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 	line := string(data[:endIdx])
 	key, val, found := strings.Cut(line, ":")
 	if !found {
-		return 0, false, fmt.Errorf("invalid header: %s", line)
+		return 0, false, fmt.Errorf("%w: %s", ErrInvalidHeader, line)
 	} else if len(key) >= 1 && key[len(key)-1] == ' ' {
-		return 0, false, fmt.Errorf("invalid header: %s", line)
+		return 0, false, fmt.Errorf("%w: %s", ErrInvalidHeader, line)
 	}
 
-	key = strings.ToLower(strings.TrimSpace(key))
+	key = strings.TrimSpace(key)
 	val = strings.TrimSpace(val)
 	validChars := makeValidCharTable()
 	if len(key) <= 0 {
-		return 0, false, fmt.Errorf("invalid header: %s", line)
+		return 0, false, fmt.Errorf("%w: %s", ErrInvalidHeader, line)
 	}
 	for _, c := range key {
 		if !validChars[c] {
-			return 0, false, fmt.Errorf("invalid header: %s", line)
+			return 0, false, fmt.Errorf("%w: %s", ErrInvalidHeader, line)
 		}
 	}
 
-	if _, ok := h[key]; ok {
-		h[key] += ", " + val
-	} else {
-		h[key] = val
-	}
+	h.Add(key, val)
 	return endIdx + len(SEPARATOR), false, nil
 }
 
-func (h Headers) Get(key string) (string, bool) {
-	val, ok := h[key]
-	return val, ok
+// Get returns every value of key joined with ", ", which RFC 9110 treats the
+// same as separate fields for list-based headers. Use Values for fields such
+// as set-cookie that can't be combined.
+func (h *Headers) Get(key string) (string, bool) {
+	vals := h.Values(key)
+	if len(vals) == 0 {
+		return "", false
+	}
+	return strings.Join(vals, ", "), true
+}
+
+func (h *Headers) Values(key string) []string {
+	var vals []string
+	for _, f := range h.fields {
+		if strings.EqualFold(f.Name, key) {
+			vals = append(vals, f.Value)
+		}
+	}
+	return vals
+}
+
+// Add appends a value for key, keeping any existing ones.
+func (h *Headers) Add(key, value string) {
+	h.fields = append(h.fields, Field{Name: key, Value: value})
+}
+
+// Set replaces any existing values of key. The field keeps the position of the
+// first existing value.
+func (h *Headers) Set(key, value string) {
+	for i, f := range h.fields {
+		if strings.EqualFold(f.Name, key) {
+			h.fields[i] = Field{Name: key, Value: value}
+			h.delFrom(key, i+1)
+			return
+		}
+	}
+	h.Add(key, value)
+}
+
+func (h *Headers) Del(key string) {
+	h.delFrom(key, 0)
+}
+
+func (h *Headers) delFrom(key string, start int) {
+	kept := h.fields[:start]
+	for _, f := range h.fields[start:] {
+		if !strings.EqualFold(f.Name, key) {
+			kept = append(kept, f)
+		}
+	}
+	h.fields = kept
+}
+
+func (h *Headers) Has(key string) bool {
+	for _, f := range h.fields {
+		if strings.EqualFold(f.Name, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fields returns a copy of the fields in order.
+func (h *Headers) Fields() []Field {
+	return append([]Field(nil), h.fields...)
+}
+
+// Len returns the number of fields, counting repeated names separately.
+func (h *Headers) Len() int {
+	return len(h.fields)
+}
+
+func (h *Headers) Clone() *Headers {
+	return &Headers{fields: h.Fields()}
+}
+
+// HasToken reports whether the comma-separated list in key contains token,
+// compared case-insensitively.
+func (h *Headers) HasToken(key, token string) bool {
+	val, ok := h.Get(key)
+	if !ok {
+		return false
+	}
+	for _, v := range strings.Split(val, ",") {
+		if strings.EqualFold(strings.TrimSpace(v), token) {
+			return true
+		}
+	}
+	return false
 }
 
-func NewHeaders() Headers {
-	return make(Headers)
+func NewHeaders() *Headers {
+	return &Headers{}
 }
 
 func makeValidCharTable() map[rune]bool {
@@ -7,6 +7,11 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+func get(h *Headers, key string) string {
+	val, _ := h.Get(key)
+	return val
+}
+
 func TestHeaders(t *testing.T) {
 	t.Run("Valid single header", func(t *testing.T) {
 		headers := NewHeaders()
@@ -14,7 +19,7 @@ func TestHeaders(t *testing.T) {
 		n, done, err := headers.Parse(data)
 		require.NoError(t, err)
 		require.NotNil(t, headers)
-		assert.Equal(t, "localhost:42069", headers["host"])
+		assert.Equal(t, "localhost:42069", get(headers, "host"))
 		assert.Equal(t, 23, n)
 		assert.False(t, done)
 	})
@@ -24,20 +29,20 @@ func TestHeaders(t *testing.T) {
 		data := []byte("Content-Type:    application/json   \r\n")
 		n, done, err := headers.Parse(data)
 		require.NoError(t, err)
-		assert.Equal(t, "application/json", headers["content-type"])
+		assert.Equal(t, "application/json", get(headers, "content-type"))
 		assert.Equal(t, 38, n)
 		assert.False(t, done)
 	})
 
 	t.Run("Valid 2 headers with existing headers", func(t *testing.T) {
 		headers := NewHeaders()
-		headers["existing-header"] = "existing-value"
+		headers.Set("existing-header", "existing-value")
 
 		// Parse first header
 		data1 := []byte("Host: localhost:8080\r\n")
 		n1, done1, err1 := headers.Parse(data1)
 		require.NoError(t, err1)
-		assert.Equal(t, "localhost:8080", headers["host"])
+		assert.Equal(t, "localhost:8080", get(headers, "host"))
 		assert.Equal(t, 22, n1)
 		assert.False(t, done1)
 
@@ -45,13 +50,13 @@ func TestHeaders(t *testing.T) {
 		data2 := []byte("Content-Type: text/html\r\n")
 		n2, done2, err2 := headers.Parse(data2)
 		require.NoError(t, err2)
-		assert.Equal(t, "text/html", headers["content-type"])
+		assert.Equal(t, "text/html", get(headers, "content-type"))
 		assert.Equal(t, 25, n2)
 		assert.False(t, done2)
 
 		// Verify existing header still exists
-		assert.Equal(t, "existing-value", headers["existing-header"])
-		assert.Len(t, headers, 3)
+		assert.Equal(t, "existing-value", get(headers, "existing-header"))
+		assert.Equal(t, 3, headers.Len())
 	})
 
 	t.Run("Valid done", func(t *testing.T) {
@@ -61,7 +66,7 @@ func TestHeaders(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, 2, n)
 		assert.True(t, done)
-		assert.Empty(t, headers)
+		assert.Zero(t, headers.Len())
 	})
 
 	t.Run("Invalid spacing header", func(t *testing.T) {
@@ -81,7 +86,7 @@ func TestHeaders(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, 0, n)
 		assert.False(t, done)
-		assert.Empty(t, headers)
+		assert.Zero(t, headers.Len())
 	})
 
 	t.Run("Invalid field-name value", func(t *testing.T) {
@@ -100,13 +105,64 @@ func TestHeaders(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, 18, n)
 		assert.False(t, done)
-		assert.Equal(t, "Zack", headers["set-person"])
+		assert.Equal(t, "Zack", get(headers, "set-person"))
 
 		data = []byte("Set-Person: Jimmy\r\n")
 		n, done, err = headers.Parse(data)
 		require.NoError(t, err)
 		assert.Equal(t, 19, n)
 		assert.False(t, done)
-		assert.Equal(t, "Zack, Jimmy", headers["set-person"])
+		assert.Equal(t, "Zack, Jimmy", get(headers, "set-person"))
 	})
 }
+
+func TestHasToken(t *testing.T) {
+	headers := NewHeaders()
+	headers.Set("connection", "keep-alive, Close")
+	assert.True(t, headers.HasToken("connection", "close"))
+	assert.True(t, headers.HasToken("connection", "keep-alive"))
+	assert.False(t, headers.HasToken("connection", "upgrade"))
+	assert.False(t, headers.HasToken("transfer-encoding", "chunked"))
+}
+
+func TestMultiValuedHeaders(t *testing.T) {
+	headers := NewHeaders()
+	data := []byte("Set-Cookie: a=1\r\nContent-Type: text/html\r\nset-cookie: b=2\r\n\r\n")
+	for {
+		n, done, err := headers.Parse(data)
+		require.NoError(t, err)
+		data = data[n:]
+		if done {
+			break
+		}
+	}
+
+	// Original casing and order are kept
+	assert.Equal(t, []Field{
+		{Name: "Set-Cookie", Value: "a=1"},
+		{Name: "Content-Type", Value: "text/html"},
+		{Name: "set-cookie", Value: "b=2"},
+	}, headers.Fields())
+	assert.Equal(t, []string{"a=1", "b=2"}, headers.Values("SET-COOKIE"))
+	assert.Equal(t, "a=1, b=2", get(headers, "set-cookie"))
+
+	headers.Add("Set-Cookie", "c=3")
+	assert.Equal(t, []string{"a=1", "b=2", "c=3"}, headers.Values("set-cookie"))
+
+	headers.Set("set-cookie", "d=4")
+	assert.Equal(t, []Field{
+		{Name: "set-cookie", Value: "d=4"},
+		{Name: "Content-Type", Value: "text/html"},
+	}, headers.Fields())
+
+	headers.Del("Content-type")
+	assert.False(t, headers.Has("content-type"))
+	_, ok := headers.Get("content-type")
+	assert.False(t, ok)
+	assert.Equal(t, 1, headers.Len())
+
+	clone := headers.Clone()
+	clone.Add("x-extra", "1")
+	assert.Equal(t, 1, headers.Len())
+	assert.Equal(t, 2, clone.Len())
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"http/internal/request"
+	"http/internal/response"
+	"http/internal/server"
+	"log"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	RequestIDHeader    = "x-request-id"
+	ResponseTimeHeader = "x-response-time"
+)
+
+// Logger logs the method, target, status and duration of every request.
+func Logger(logger *log.Logger) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			start := time.Now()
+			next(w, req)
+			logger.Printf("%s %s %d %v", req.RequestLine.Method, req.RequestLine.RequestTarget, w.StatusCode(), time.Since(start))
+		}
+	}
+}
+
+// Recover turns a panicking handler into a 500 response. If the handler had
+// already sent part of its response, the connection is closed instead since
+// the response cannot be completed.
+func Recover(logger *log.Logger) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				logger.Printf("panic serving %s: %v\n%s", req.RequestLine.RequestTarget, rec, debug.Stack())
+				w.SetKeepAlive(false)
+				if !w.Reset() {
+					return
+				}
+				err := &server.HandlerError{
+					StatusCode: response.StatusCode500,
+					Message:    "Internal Server Error",
+				}
+				err.Write(w)
+			}()
+			next(w, req)
+		}
+	}
+}
+
+// RequestID tags the request and response with an x-request-id header,
+// keeping the client's value if it sent one.
+func RequestID() server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			id, ok := req.Headers.Get(RequestIDHeader)
+			if !ok || id == "" {
+				id = newRequestID()
+				req.Headers.Set(RequestIDHeader, id)
+			}
+			w.Header().Set(RequestIDHeader, id)
+			next(w, req)
+		}
+	}
+}
+
+// Timing reports how long the handler took before writing headers in an
+// x-response-time header.
+func Timing() server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			start := time.Now()
+			w.BeforeHeaders(func() {
+				w.Header().Set(ResponseTimeHeader, fmt.Sprintf("%.3fms", float64(time.Since(start).Microseconds())/1000))
+			})
+			next(w, req)
+		}
+	}
+}
+
+// Conditional gives 200 responses an etag and answers conditional requests
+// for them with 304 Not Modified or 412 Precondition Failed. Bodies without
+// an etag are buffered in full to compute one.
+func Conditional() server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			w.HandleConditional(req.RequestLine.Method, req.Headers)
+			next(w, req)
+		}
+	}
+}
+
+// Compress sends response bodies gzip or deflate encoded to clients that
+// accept it. Responses to HEAD requests get the same encoding headers as a
+// GET would, without a body to encode.
+func Compress() server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			w.HandleCompression(req.Headers)
+			next(w, req)
+		}
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
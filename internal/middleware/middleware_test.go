@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"http/internal/request"
+	"http/internal/response"
+	"http/internal/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func run(t *testing.T, h server.Handler, raw string) (*response.Writer, string) {
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	w := response.NewWriter(&buf)
+	w.SetKeepAlive(true)
+	if req.RequestLine.Method == "HEAD" {
+		w.SuppressBody()
+	}
+	h(w, req)
+	return w, buf.String()
+}
+
+func ok(w *response.Writer, req *request.Request) {
+	w.WriteStatusLine(response.StatusCode200)
+	w.WriteHeaders(response.GetDefaultHeaders(2))
+	w.WriteBody([]byte("ok"))
+}
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	tag := func(name string) server.Middleware {
+		return func(next server.Handler) server.Handler {
+			return func(w *response.Writer, req *request.Request) {
+				calls = append(calls, name)
+				next(w, req)
+			}
+		}
+	}
+	h := server.Chain(tag("a"), tag("b"), tag("c"))(ok)
+	run(t, h, "GET / HTTP/1.1\r\n\r\n")
+	assert.Equal(t, []string{"a", "b", "c"}, calls)
+}
+
+func TestRecover(t *testing.T) {
+	var logs bytes.Buffer
+	h := Recover(log.New(&logs, "", 0))(func(w *response.Writer, req *request.Request) {
+		panic("boom")
+	})
+	w, out := run(t, h, "GET / HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 500 Internal Server Error\r\n"))
+	assert.False(t, w.KeepAlive())
+	assert.Contains(t, logs.String(), "boom")
+}
+
+func TestRequestIDAndTiming(t *testing.T) {
+	h := server.Chain(RequestID(), Timing())(ok)
+
+	_, out := run(t, h, "GET / HTTP/1.1\r\nX-Request-Id: abc\r\n\r\n")
+	assert.Contains(t, out, "x-request-id: abc\r\n")
+	assert.Contains(t, out, "x-response-time: ")
+
+	_, out = run(t, h, "GET / HTTP/1.1\r\n\r\n")
+	assert.Regexp(t, "x-request-id: [0-9a-f]{32}\r\n", out)
+}
+
+func TestLogger(t *testing.T) {
+	var logs bytes.Buffer
+	h := Logger(log.New(&logs, "", 0))(ok)
+	run(t, h, "GET /coffee HTTP/1.1\r\n\r\n")
+	assert.Contains(t, logs.String(), "GET /coffee 200")
+}
+
+func TestConditional(t *testing.T) {
+	h := Conditional()(func(w *response.Writer, req *request.Request) {
+		w.Write([]byte("ok"))
+		w.Finish()
+	})
+	etag := response.ETag([]byte("ok"))
+
+	_, out := run(t, h, "GET / HTTP/1.1\r\n\r\n")
+	assert.Contains(t, out, "etag: "+etag+"\r\n")
+	_, out = run(t, h, "GET / HTTP/1.1\r\nIf-None-Match: "+etag+"\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 304 Not Modified\r\n"))
+	assert.False(t, strings.HasSuffix(out, "ok"))
+}
+
+func TestCompress(t *testing.T) {
+	h := Compress()(func(w *response.Writer, req *request.Request) {
+		w.Write([]byte(strings.Repeat("compress me ", 100)))
+		w.Finish()
+	})
+	_, out := run(t, h, "GET / HTTP/1.1\r\nAccept-Encoding: gzip\r\n\r\n")
+	assert.Contains(t, out, "content-encoding: gzip\r\n")
+	_, out = run(t, h, "GET / HTTP/1.1\r\nAccept-Encoding: br\r\n\r\n")
+	assert.NotContains(t, out, "content-encoding")
+	_, out = run(t, h, "HEAD / HTTP/1.1\r\nAccept-Encoding: gzip\r\n\r\n")
+	assert.Contains(t, out, "content-encoding: gzip\r\n")
+	assert.Contains(t, out, "transfer-encoding: chunked\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n"))
+}
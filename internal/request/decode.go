@@ -0,0 +1,125 @@
+package request
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// DecodeBody makes BodyReader return the body with its content-encoding
+// undone, so handlers see the data as the client had it before compressing.
+// gzip and deflate are supported, applied in any order. Decoding stops with
+// ErrBodyTooLarge once more than maxBytes come out, so a small body can't
+// expand into something huge; zero means no limit. The content-encoding and
+// content-length headers are removed since they no longer describe the body.
+func (r *Request) DecodeBody(maxBytes int64) error {
+	val, ok := r.Headers.Get("content-encoding")
+	if !ok {
+		return nil
+	}
+	var codings []string
+	for _, coding := range strings.Split(val, ",") {
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		switch coding {
+		case "", "identity":
+		case "gzip", "x-gzip", "deflate":
+			codings = append(codings, coding)
+		default:
+			return fmt.Errorf("%w: %s", ErrUnsupportedContentEncoding, coding)
+		}
+	}
+	r.Headers.Del("content-encoding")
+	if len(codings) == 0 {
+		return nil
+	}
+	r.Headers.Del("content-length")
+
+	src := &sourceReader{r: r.BodyReader}
+	var rd io.Reader = src
+	// The last coding listed was applied last, so it comes off first
+	for _, coding := range slices.Backward(codings) {
+		rd = &lazyDecoder{coding: coding, r: rd}
+	}
+	r.BodyReader = &decodedBody{src: src, r: rd, closer: r.BodyReader, max: maxBytes}
+	return nil
+}
+
+// sourceReader remembers the last error of the encoded body, telling errors
+// reading the request apart from errors in what was read.
+type sourceReader struct {
+	r   io.Reader
+	err error
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil {
+		s.err = err
+	}
+	return n, err
+}
+
+// lazyDecoder only starts decoding on the first read, since setting up a
+// decoder already reads the start of the body.
+type lazyDecoder struct {
+	coding string
+	r      io.Reader
+	dec    io.Reader
+}
+
+func (d *lazyDecoder) Read(p []byte) (int, error) {
+	if d.dec == nil {
+		var err error
+		if d.coding == "deflate" {
+			d.dec, err = zlib.NewReader(d.r)
+		} else {
+			d.dec, err = gzip.NewReader(d.r)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return d.dec.Read(p)
+}
+
+type decodedBody struct {
+	src    *sourceReader
+	r      io.Reader
+	closer io.Closer
+	max    int64
+	read   int64
+	err    error
+}
+
+func (b *decodedBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.max > 0 {
+		// Read one byte past the limit to tell a body that just fits from
+		// one that goes over
+		p = p[:min(int64(len(p)), b.max-b.read+1)]
+	}
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF && (b.src.err == nil || b.src.err == io.EOF) {
+		err = fmt.Errorf("%w: %v", ErrInvalidEncodedBody, err)
+	}
+	b.read += int64(n)
+	if b.max > 0 && b.read > b.max {
+		n -= int(b.read - b.max)
+		b.read = b.max
+		err = fmt.Errorf("%w: decoded body over %d bytes", ErrBodyTooLarge, b.max)
+	}
+	if err != nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// Close discards the rest of the encoded body without decoding it.
+func (b *decodedBody) Close() error {
+	return b.closer.Close()
+}
@@ -0,0 +1,29 @@
+package request
+
+import (
+	"errors"
+	"http/internal/framing"
+)
+
+// Parse errors returned by ReadRequest. They are wrapped with details about
+// the offending input, so use errors.Is to tell them apart.
+var (
+	ErrInvalidRequestLine   = errors.New("invalid request line")
+	ErrRequestLineTooLong   = errors.New("request line too long")
+	ErrUnsupportedVersion   = errors.New("unsupported HTTP version")
+	ErrInvalidContentLength = framing.ErrInvalidContentLength
+	ErrInvalidFraming       = framing.ErrInvalidFraming
+	ErrUnsupportedEncoding  = framing.ErrUnsupportedEncoding
+	ErrInvalidChunk         = framing.ErrInvalidChunk
+	ErrBodyTooLarge         = errors.New("request body too large")
+)
+
+// Errors returned by DecodeBody and reads of a decoded body.
+var (
+	ErrUnsupportedContentEncoding = errors.New("unsupported content-encoding")
+	ErrInvalidEncodedBody         = errors.New("invalid encoded body")
+)
+
+// ErrUnreadBody is returned by ReadRequest and WaitForRequest when the body of
+// the previous request was left unread and is too large to discard.
+var ErrUnreadBody = framing.ErrBodyNotDrained
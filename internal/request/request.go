@@ -3,23 +3,50 @@ package request
 import (
 	"bytes"
 	"fmt"
+	"http/internal/framing"
 	"http/internal/headers"
 	"io"
-	"strconv"
 	"strings"
-	"unicode"
 )
 
 type Request struct {
 	RequestLine RequestLine
-	Headers     headers.Headers
-	Body        []byte
+	Headers     *headers.Headers
+	// Body is only populated once BufferBody has been called.
+	Body []byte
+	// BodyReader streams the body off the connection as it is read.
+	BodyReader io.ReadCloser
+	// Trailers is populated once a chunked body has been read to the end.
+	Trailers *headers.Headers
+	// PathParams holds the values matched by router patterns like /users/{id}.
+	PathParams  map[string]string
 	state       parserState
+	limits      Limits
+	headerBytes int
+	headerCount int
+}
+
+// Limits bounds the size of the requests a Reader accepts. A zero field
+// means no limit.
+type Limits struct {
+	MaxRequestLineBytes int
+	// MaxHeaderBytes and MaxHeaderCount also apply to chunked trailers.
+	MaxHeaderBytes int
+	MaxHeaderCount int
+	MaxBodyBytes   int64
+}
+
+var DefaultLimits = Limits{
+	MaxRequestLineBytes: 8 << 10,
+	MaxHeaderBytes:      1 << 20,
+	MaxHeaderCount:      100,
 }
 
 type RequestLine struct {
-	Method        string
+	Method string
+	// RequestTarget is the target as sent, Target its parsed form.
 	RequestTarget string
+	Target        Target
 	HttpVersion   string
 }
 
@@ -30,68 +57,148 @@ const (
 
 	stateInitialized    = 0
 	stateParsingHeaders = 1
-	stateParsingBody    = 2
-	stateDone           = 3
+	stateDone           = 2
 )
 
-var (
-	cmds = map[string]bool{
-		"GET":    true,
-		"POST":   true,
-		"PUT":    true,
-		"DELETE": true,
-	}
-)
+// Reader parses successive requests off a single connection, keeping any
+// bytes read past the end of one request for the next.
+type Reader struct {
+	Limits Limits
+	conn   *framing.Conn
+	body   *framing.Body
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{Limits: DefaultLimits, conn: framing.NewConn(reader)}
+}
 
+// RequestFromReader reads a single request and buffers its body into Body.
 func RequestFromReader(reader io.Reader) (*Request, error) {
+	req, err := NewReader(reader).ReadRequest()
+	if err != nil {
+		return nil, err
+	}
+	if err := req.BufferBody(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// ReadRequest parses the request line and headers and returns with the body
+// left unread on BodyReader. Any unread body of the previous request is
+// discarded first. It returns io.EOF if the connection is closed before any
+// bytes of a new request arrive.
+func (rr *Reader) ReadRequest() (*Request, error) {
+	if err := rr.discardBody(); err != nil {
+		return nil, err
+	}
+
 	req := &Request{
 		state:   0,
 		Headers: headers.NewHeaders(),
+		limits:  rr.Limits,
 	}
-
-	buf := make([]byte, 8)
-	readIdx := 0
 	for req.state != stateDone {
-		consumed, err := req.parse(buf[:readIdx])
-		if err != nil {
+		if err := rr.advance(req); err != nil {
 			return nil, err
 		}
+	}
 
-		if consumed > 0 {
-			copy(buf, buf[consumed:])
-			readIdx -= consumed
-			continue
-		}
-
-		if req.state == stateDone {
-			break
-		}
-
-		if readIdx >= len(buf) {
-			newBuf := make([]byte, len(buf)*2)
-			copy(newBuf, buf[:readIdx])
-			buf = newBuf
+	length, chunked, err := framing.Length(req.Headers)
+	if err != nil {
+		return nil, err
+	}
+	if chunked {
+		req.Trailers = headers.NewHeaders()
+		rr.body = framing.NewChunkedBody(rr.conn, framing.Chunked{
+			MaxBytes:    req.limits.MaxBodyBytes,
+			ErrTooLarge: ErrBodyTooLarge,
+			ParseTrailer: func(data []byte) (int, bool, error) {
+				return req.parseFieldLine(req.Trailers, data)
+			},
+		})
+	} else {
+		if req.limits.MaxBodyBytes > 0 && length > req.limits.MaxBodyBytes {
+			return nil, fmt.Errorf("%w: content-length %d", ErrBodyTooLarge, length)
 		}
+		rr.body = framing.NewLengthBody(rr.conn, length)
+	}
+	req.BodyReader = rr.body
+	return req, nil
+}
 
-		n, err := reader.Read(buf[readIdx:])
-		if err == io.EOF {
-			if req.state == stateParsingBody {
-				return nil, fmt.Errorf("unexpected EOF while reading body")
-			}
-			req.state = stateDone
-			break
+// WaitForRequest blocks until the first bytes of the next request arrive,
+// letting callers time the wait between requests separately from reading the
+// request itself. It returns io.EOF if the connection is closed first.
+func (rr *Reader) WaitForRequest() error {
+	if err := rr.discardBody(); err != nil {
+		return err
+	}
+	for len(rr.conn.Buffered()) == 0 {
+		n, err := rr.conn.Fill()
+		if n > 0 {
+			return nil
 		}
 		if err != nil {
-			return nil, err
+			return err
 		}
-		readIdx += n
 	}
+	return nil
+}
 
-	return req, nil
+// CanDiscardBody reports whether whatever is left of the current body is small
+// enough to be discarded before the next request is read.
+func (rr *Reader) CanDiscardBody() bool {
+	return rr.body == nil || rr.body.Drainable()
+}
+
+func (rr *Reader) discardBody() error {
+	if rr.body == nil {
+		return nil
+	}
+	err := rr.body.Close()
+	rr.body = nil
+	return err
+}
+
+// BufferBody reads the rest of the body into Body and replaces BodyReader
+// with a reader over the buffered bytes.
+func (r *Request) BufferBody() error {
+	data, err := io.ReadAll(r.BodyReader)
+	if err != nil {
+		return err
+	}
+	r.Body = data
+	r.BodyReader = io.NopCloser(bytes.NewReader(data))
+	return nil
+}
+
+func (r *Request) PathValue(name string) string {
+	return r.PathParams[name]
+}
+
+func (r *Request) SetPathValue(name, value string) {
+	if r.PathParams == nil {
+		r.PathParams = make(map[string]string)
+	}
+	r.PathParams[name] = value
+}
+
+// advance feeds buffered data to the parser, reading more from the
+// connection until the parser makes progress.
+func (rr *Reader) advance(req *Request) error {
+	err := rr.conn.Next(req.parse)
+	if err == io.EOF && (req.state != stateInitialized || len(rr.conn.Buffered()) > 0) {
+		return fmt.Errorf("%w while reading request", io.ErrUnexpectedEOF)
+	}
+	return err
 }
 
-func parseRequestLine(data []byte) (*RequestLine, int, error) {
+func parseRequestLine(data []byte, maxBytes int) (*RequestLine, int, error) {
 	endIdx := bytes.Index(data, []byte(SEPARATOR))
+	if maxBytes > 0 && (endIdx > maxBytes || (endIdx == -1 && len(data) > maxBytes)) {
+		return nil, 0, ErrRequestLineTooLong
+	}
 	if endIdx == -1 {
 		return nil, 0, nil
 	}
@@ -99,23 +206,30 @@ func parseRequestLine(data []byte) (*RequestLine, int, error) {
 
 	requestLine := strings.Split(string(line), " ")
 	if len(requestLine) != 3 {
-		return nil, 0, fmt.Errorf("invalid request line: %s", string(line))
+		return nil, 0, fmt.Errorf("%w: %s", ErrInvalidRequestLine, line)
 	}
 
 	method, reqTarget := requestLine[0], requestLine[1]
-	version := strings.TrimPrefix(requestLine[2], "HTTP/")
+	version, ok := strings.CutPrefix(requestLine[2], "HTTP/")
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: %s", ErrInvalidRequestLine, line)
+	}
 	if version != "1.1" {
-		return nil, 0, fmt.Errorf("unsupported HTTP version: %s", version)
+		return nil, 0, fmt.Errorf("%w: %s", ErrUnsupportedVersion, version)
 	}
-	if !cmds[method] || !isAllUppercase(method) {
-		return nil, 0, fmt.Errorf("unsupported command: %s", requestLine[0])
+	// Any token is allowed so extension methods reach the handler, which
+	// can answer 405 or 501 for those it doesn't know
+	if !isToken(method) {
+		return nil, 0, fmt.Errorf("%w: invalid method: %s", ErrInvalidRequestLine, method)
 	}
-	if !strings.HasPrefix(reqTarget, "/") {
-		return nil, 0, fmt.Errorf("request target must start with /: %s", reqTarget)
+	target, err := parseTarget(method, reqTarget)
+	if err != nil {
+		return nil, 0, err
 	}
 	reqLine := &RequestLine{
 		Method:        requestLine[0],
 		RequestTarget: requestLine[1],
+		Target:        target,
 		HttpVersion:   strings.TrimPrefix(requestLine[2], "HTTP/"),
 	}
 	return reqLine, endIdx + len(SEPARATOR), nil
@@ -126,62 +240,57 @@ func (r *Request) parse(data []byte) (int, error) {
 	case stateDone:
 		return 0, fmt.Errorf("request already parsed")
 	case stateInitialized:
-		reqLine, bytesRead, err := parseRequestLine(data)
-		if err != nil {
+		reqLine, bytesRead, err := parseRequestLine(data, r.limits.MaxRequestLineBytes)
+		if err != nil || bytesRead == 0 {
 			return 0, err
 		}
-		if bytesRead == 0 {
-			return 0, nil
-		}
 		r.RequestLine = *reqLine
 		r.state = stateParsingHeaders
 		return bytesRead, nil
 	case stateParsingHeaders:
-		bytesRead, done, err := r.Headers.Parse(data)
+		bytesRead, done, err := r.parseFieldLine(r.Headers, data)
 		if err != nil {
 			return 0, err
 		}
 		if !done {
 			return bytesRead, nil
 		}
-		r.state = stateParsingBody
+		r.state = stateDone
 		return bytesRead, nil
-	case stateParsingBody:
-		sizeVal, ok := r.Headers.Get("content-length")
-		if !ok {
-			r.state = stateDone
-			return 0, nil
-		}
-		contentSize, err := strconv.Atoi(sizeVal)
-		if err != nil {
-			return 0, fmt.Errorf("invalid content-length header: %s", sizeVal)
-		}
+	default:
+		return 0, fmt.Errorf("invalid state: %d", r.state)
+	}
+}
 
-		if contentSize == 0 {
-			r.Body = []byte{}
-			r.state = stateDone
-			return 0, nil
-		}
-		// Need more data to parse
-		if len(data) < contentSize {
-			return 0, nil
+// parseFieldLine parses a header or trailer line into h, enforcing the header
+// size and count limits across both.
+func (r *Request) parseFieldLine(h *headers.Headers, data []byte) (int, bool, error) {
+	bytesRead, done, err := h.Parse(data)
+	if err != nil {
+		return 0, false, err
+	}
+	r.headerBytes += bytesRead
+	if maxBytes := r.limits.MaxHeaderBytes; maxBytes > 0 {
+		if r.headerBytes > maxBytes || (bytesRead == 0 && r.headerBytes+len(data) > maxBytes) {
+			return 0, false, headers.ErrHeaderTooLarge
 		}
-		// Data size does not match content-length
-		if len(data) > contentSize {
-			return 0, fmt.Errorf("invalid content-length header: %d", contentSize)
+	}
+	if bytesRead > 0 && !done {
+		r.headerCount++
+		if r.limits.MaxHeaderCount > 0 && r.headerCount > r.limits.MaxHeaderCount {
+			return 0, false, headers.ErrTooManyHeaders
 		}
-		r.Body = make([]byte, contentSize)
-		copy(r.Body, data)
-		r.state = stateDone
-		return contentSize, nil
-	default:
-		return 0, fmt.Errorf("invalid state: %d", r.state)
 	}
+	return bytesRead, done, nil
 }
 
-func isAllUppercase(s string) bool {
-	for _, r := range s {
-		if unicode.IsLetter(r) && !unicode.IsUpper(r) {
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlnum && !strings.ContainsRune("!#$%&'*+-.^_`|~", c) {
 			return false
 		}
 	}
@@ -1,10 +1,16 @@
 package request
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"io"
+	"strconv"
 	"strings"
 	"testing"
 
+	"http/internal/headers"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -26,6 +32,11 @@ func (r *chunkReader) Read(p []byte) (n int, err error) {
 	return n, nil
 }
 
+func get(h *headers.Headers, key string) string {
+	val, _ := h.Get(key)
+	return val
+}
+
 func TestRequestLineParse(t *testing.T) {
 	assert.Equal(t, "foo", "foo")
 }
@@ -106,9 +117,9 @@ func TestHeaderFromReader(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	assert.Equal(t, "localhost:42069", get(r.Headers, "host"))
+	assert.Equal(t, "curl/7.81.0", get(r.Headers, "user-agent"))
+	assert.Equal(t, "*/*", get(r.Headers, "accept"))
 
 	// Test: Empty Headers
 	reader = &chunkReader{
@@ -118,7 +129,7 @@ func TestHeaderFromReader(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Empty(t, r.Headers)
+	assert.Zero(t, r.Headers.Len())
 
 	// Test: Malformed Header (missing colon)
 	reader = &chunkReader{
@@ -136,7 +147,8 @@ func TestHeaderFromReader(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "first.com, second.com", r.Headers["host"])
+	assert.Equal(t, "first.com, second.com", get(r.Headers, "host"))
+	assert.Equal(t, []string{"first.com", "second.com"}, r.Headers.Values("host"))
 
 	// Test: Case Insensitive Headers
 	reader = &chunkReader{
@@ -146,7 +158,7 @@ func TestHeaderFromReader(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069, uppercase.com, lowercase.com", r.Headers["host"])
+	assert.Equal(t, "localhost:42069, uppercase.com, lowercase.com", get(r.Headers, "host"))
 
 }
 
@@ -195,21 +207,33 @@ func TestRequestFromReader(t *testing.T) {
 	_, err = RequestFromReader(strings.NewReader("GET /coffee HTTP/2.0\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n"))
 	require.Error(t, err)
 
-	// Test: Unsupported command
+	// Test: Extension command
 	cr = &chunkReader{
 		data:            "FOO /coffee HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
 		numBytesPerRead: 8,
 	}
-	_, err = RequestFromReader(cr)
-	require.Error(t, err)
+	r, err = RequestFromReader(cr)
+	require.NoError(t, err)
+	assert.Equal(t, "FOO", r.RequestLine.Method)
 
-	// Test: Lowercase command
+	// Test: Methods are case-sensitive, so lowercase is a different method
 	cr = &chunkReader{
 		data:            "get /coffee HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
 		numBytesPerRead: 8,
 	}
-	_, err = RequestFromReader(cr)
-	require.Error(t, err)
+	r, err = RequestFromReader(cr)
+	require.NoError(t, err)
+	assert.Equal(t, "get", r.RequestLine.Method)
+
+	// Test: Standard methods
+	for _, method := range []string{"HEAD", "OPTIONS", "PATCH", "TRACE"} {
+		r, err = RequestFromReader(strings.NewReader(method + " /coffee HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+		assert.Equal(t, method, r.RequestLine.Method)
+	}
+	r, err = RequestFromReader(strings.NewReader("CONNECT example.com:443 HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, AuthorityForm, r.RequestLine.Target.Form)
 
 	// Test: Request target not starting with /
 	cr = &chunkReader{
@@ -243,3 +267,382 @@ func TestRequestFromReader(t *testing.T) {
 	assert.Equal(t, "/", r.RequestLine.RequestTarget)
 	assert.Equal(t, "1.1", r.RequestLine.HttpVersion)
 }
+
+func TestReaderMultipleRequests(t *testing.T) {
+	// Test: Pipelined requests on one connection
+	cr := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello" +
+			"GET /next HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"\r\n",
+		numBytesPerRead: 7,
+	}
+	rr := NewReader(cr)
+	r, err := rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/submit", r.RequestLine.RequestTarget)
+	body, err := io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "GET", r.RequestLine.Method)
+	assert.Equal(t, "/next", r.RequestLine.RequestTarget)
+
+	// Test: Connection closed between requests
+	_, err = rr.ReadRequest()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestChunkedBodyFromReader(t *testing.T) {
+	// Test: Chunked body with extension and trailers
+	cr := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"6;name=value\r\n" +
+			"hello \r\n" +
+			"7\r\n" +
+			"world!\n\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc123\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(cr)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "hello world!\n", string(r.Body))
+	assert.Equal(t, "abc123", get(r.Trailers, "x-checksum"))
+
+	// Test: Chunked body without trailers
+	cr = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"a\r\n" +
+			"0123456789\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = RequestFromReader(cr)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(r.Body))
+	assert.Zero(t, r.Trailers.Len())
+
+	// Test: Both content-length and transfer-encoding
+	cr = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Content-Length: 5\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(cr)
+	require.Error(t, err)
+
+	// Test: Invalid chunk size
+	cr = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"zz\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(cr)
+	require.Error(t, err)
+
+	// Test: Chunk data longer than chunk size
+	cr = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(cr)
+	require.Error(t, err)
+
+	// Test: Missing terminating chunk
+	cr = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(cr)
+	require.Error(t, err)
+}
+
+func TestStreamingBody(t *testing.T) {
+	// Test: Body is read lazily off the connection
+	cr := &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Content-Length: 11\r\n" +
+			"\r\n" +
+			"hello world",
+		numBytesPerRead: 4,
+	}
+	rr := NewReader(cr)
+	r, err := rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Nil(t, r.Body)
+	assert.Less(t, cr.pos, len(cr.data))
+	buf := make([]byte, 5)
+	n, err := io.ReadFull(r.BodyReader, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+	rest, err := io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, " world", string(rest))
+
+	// Test: Chunked body streamed, trailers available at the end
+	cr = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n6\r\n world\r\n0\r\nX-Done: yes\r\n\r\n",
+		numBytesPerRead: 2,
+	}
+	r, err = NewReader(cr).ReadRequest()
+	require.NoError(t, err)
+	body, err := io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(body))
+	assert.Equal(t, "yes", get(r.Trailers, "x-done"))
+
+	// Test: Unread body is discarded before the next request
+	cr = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n0\r\n\r\n" +
+			"GET /next HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 5,
+	}
+	rr = NewReader(cr)
+	_, err = rr.ReadRequest()
+	require.NoError(t, err)
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/next", r.RequestLine.RequestTarget)
+
+	// Test: Buffered mode
+	cr = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello",
+		numBytesPerRead: 3,
+	}
+	r, err = NewReader(cr).ReadRequest()
+	require.NoError(t, err)
+	require.NoError(t, r.BufferBody())
+	assert.Equal(t, "hello", string(r.Body))
+	body, err = io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := RequestFromReader(strings.NewReader("GET / HTTP/2.0\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+
+	_, err = RequestFromReader(strings.NewReader("GET / FTP/1.1\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrInvalidRequestLine)
+
+	_, err = RequestFromReader(strings.NewReader("GE(T / HTTP/1.1\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrInvalidRequestLine)
+
+	_, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nContent-Length: -1\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrInvalidContentLength)
+
+	_, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrUnsupportedEncoding)
+
+	_, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nTransfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrUnsupportedEncoding)
+
+	_, err = RequestFromReader(strings.NewReader("GET /" + strings.Repeat("a", 10000) + " HTTP/1.1\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	_, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost"))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestRequestLimits(t *testing.T) {
+	read := func(raw string, limits Limits) (*Request, error) {
+		rr := NewReader(&chunkReader{data: raw, numBytesPerRead: 7})
+		rr.Limits = limits
+		return rr.ReadRequest()
+	}
+
+	// Test: Request line over the limit
+	_, err := read("GET /0123456789 HTTP/1.1\r\n\r\n", Limits{MaxRequestLineBytes: 16})
+	assert.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// Test: Headers over the byte limit
+	_, err = read("GET / HTTP/1.1\r\nX-Long: "+strings.Repeat("a", 64)+"\r\n\r\n", Limits{MaxHeaderBytes: 32})
+	assert.ErrorIs(t, err, headers.ErrHeaderTooLarge)
+
+	// Test: Too many headers
+	_, err = read("GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n", Limits{MaxHeaderCount: 2})
+	assert.ErrorIs(t, err, headers.ErrTooManyHeaders)
+
+	// Test: Headers at the count limit
+	_, err = read("GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\n\r\n", Limits{MaxHeaderCount: 2})
+	assert.NoError(t, err)
+
+	// Test: Content-length over the body limit
+	_, err = read("POST / HTTP/1.1\r\nContent-Length: 11\r\n\r\nhello world", Limits{MaxBodyBytes: 10})
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Chunked body over the body limit is caught while streaming
+	r, err := read("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n"+
+		"6\r\nhello \r\n5\r\nworld\r\n0\r\n\r\n", Limits{MaxBodyBytes: 10})
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.BodyReader)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+}
+
+func gzipped(t *testing.T, data string) string {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.String()
+}
+
+func TestDecodeBody(t *testing.T) {
+	read := func(contentEncoding, body string, maxBytes int64) (*Request, error) {
+		raw := "POST / HTTP/1.1\r\n" +
+			"Content-Encoding: " + contentEncoding + "\r\n" +
+			"Content-Length: " + strconv.Itoa(len(body)) + "\r\n" +
+			"\r\n" + body
+		r, err := NewReader(&chunkReader{data: raw, numBytesPerRead: 7}).ReadRequest()
+		require.NoError(t, err)
+		if err := r.DecodeBody(maxBytes); err != nil {
+			return r, err
+		}
+		return r, r.BufferBody()
+	}
+
+	// Test: gzip body
+	r, err := read("gzip", gzipped(t, "hello world"), 0)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(r.Body))
+	assert.False(t, r.Headers.Has("content-encoding"))
+	assert.False(t, r.Headers.Has("content-length"))
+
+	// Test: deflate applied on top of gzip
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte(gzipped(t, "layered")))
+	zw.Close()
+	r, err = read("gzip, deflate", buf.String(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, "layered", string(r.Body))
+
+	// Test: identity leaves the body alone
+	r, err = read("identity", "plain", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "plain", string(r.Body))
+	assert.Equal(t, "5", get(r.Headers, "content-length"))
+
+	// Test: Body exactly at the limit
+	r, err = read("gzip", gzipped(t, "hello world"), 11)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(r.Body))
+
+	// Test: A small body that expands past the limit
+	bomb := gzipped(t, strings.Repeat("\x00", 1<<20))
+	assert.Less(t, len(bomb), 4<<10)
+	_, err = read("gzip", bomb, 64<<10)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Unsupported and corrupt encodings
+	_, err = read("br", "data", 0)
+	assert.ErrorIs(t, err, ErrUnsupportedContentEncoding)
+	_, err = read("gzip", "not gzip at all", 0)
+	assert.ErrorIs(t, err, ErrInvalidEncodedBody)
+	truncated := gzipped(t, "hello world")
+	_, err = read("gzip", truncated[:len(truncated)-4], 0)
+	assert.ErrorIs(t, err, ErrInvalidEncodedBody)
+
+	// Test: Requests without a content-encoding aren't touched
+	r, err = NewReader(strings.NewReader("GET / HTTP/1.1\r\n\r\n")).ReadRequest()
+	require.NoError(t, err)
+	body := r.BodyReader
+	require.NoError(t, r.DecodeBody(10))
+	assert.Equal(t, body, r.BodyReader)
+}
+
+func TestRequestTarget(t *testing.T) {
+	// Test: Origin-form with an encoded path and query
+	r, err := RequestFromReader(strings.NewReader("GET /a%20b/c%2Fd?x=1&y=two%20words&x=3 HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	target := r.RequestLine.Target
+	assert.Equal(t, OriginForm, target.Form)
+	assert.Equal(t, "/a b/c/d", target.Path)
+	assert.Equal(t, "/a%20b/c%2Fd", target.RawPath)
+	assert.Equal(t, "x=1&y=two%20words&x=3", target.RawQuery)
+	assert.Equal(t, []string{"1", "3"}, target.Query()["x"])
+	assert.Equal(t, "two words", target.Query().Get("y"))
+
+	// Test: Absolute-form
+	r, err = RequestFromReader(strings.NewReader("GET HTTP://example.com:8080/p?q=1 HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	target = r.RequestLine.Target
+	assert.Equal(t, AbsoluteForm, target.Form)
+	assert.Equal(t, "http", target.Scheme)
+	assert.Equal(t, "example.com:8080", target.Host)
+	assert.Equal(t, "/p", target.Path)
+	assert.Equal(t, "q=1", target.RawQuery)
+
+	tests := []struct {
+		method string
+		target string
+		want   Target
+	}{
+		{"GET", "/", Target{Form: OriginForm, Path: "/", RawPath: "/"}},
+		{"GET", "/?", Target{Form: OriginForm, Path: "/", RawPath: "/"}},
+		{"GET", "http://example.com", Target{Form: AbsoluteForm, Scheme: "http", Host: "example.com", Path: "/", RawPath: "/"}},
+		{"GET", "http://example.com?a", Target{Form: AbsoluteForm, Scheme: "http", Host: "example.com", Path: "/", RawPath: "/", RawQuery: "a"}},
+		{"CONNECT", "example.com:443", Target{Form: AuthorityForm, Host: "example.com:443"}},
+		{"OPTIONS", "*", Target{Form: AsteriskForm, Path: "*", RawPath: "*"}},
+	}
+	for _, tc := range tests {
+		got, err := parseTarget(tc.method, tc.target)
+		require.NoError(t, err, tc.target)
+		assert.Equal(t, tc.want, got, tc.target)
+	}
+
+	// Test: Invalid targets
+	for _, tc := range []struct{ method, target string }{
+		{"GET", "/page#section"},
+		{"GET", "/bad%zzescape"},
+		{"GET", "/tab\there"},
+		{"GET", "relative/path"},
+		{"GET", "*"},
+		{"GET", "example.com:443"},
+		{"GET", "http:///nohost"},
+		{"GET", "http://user@example.com/"},
+		{"GET", "1http://example.com/"},
+		{"CONNECT", "/"},
+		{"CONNECT", "example.com"},
+		{"OPTIONS", "**"},
+	} {
+		_, err := parseTarget(tc.method, tc.target)
+		assert.ErrorIs(t, err, ErrInvalidRequestLine, tc.target)
+	}
+}
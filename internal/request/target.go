@@ -0,0 +1,117 @@
+package request
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// TargetForm is which of the four request-target forms of RFC 9112 section
+// 3.2 a request used.
+type TargetForm int
+
+const (
+	// OriginForm is an absolute path and optional query, as in GET /a?b.
+	OriginForm TargetForm = iota
+	// AbsoluteForm is a full URI, as sent to proxies.
+	AbsoluteForm
+	// AuthorityForm is the host:port of a CONNECT request.
+	AuthorityForm
+	// AsteriskForm is the * of a server-wide OPTIONS request.
+	AsteriskForm
+)
+
+// Target is the parsed request-target.
+type Target struct {
+	Form TargetForm
+	// Scheme and Host are set for absolute-form targets. Host is also set
+	// for authority-form ones, where it is the whole target.
+	Scheme string
+	Host   string
+	// Path has percent-encoding decoded. RawPath is the path as sent, for
+	// when an encoded / has to be told apart from a real one.
+	Path     string
+	RawPath  string
+	RawQuery string
+}
+
+// Query parses the query string. Malformed pairs are skipped.
+func (t *Target) Query() url.Values {
+	values, _ := url.ParseQuery(t.RawQuery)
+	return values
+}
+
+func parseTarget(method, s string) (Target, error) {
+	for i := 0; i < len(s); i++ {
+		if s[i] <= ' ' || s[i] == 0x7f {
+			return Target{}, fmt.Errorf("%w: invalid character in request target: %q", ErrInvalidRequestLine, s)
+		}
+	}
+	if strings.Contains(s, "#") {
+		return Target{}, fmt.Errorf("%w: fragment in request target: %s", ErrInvalidRequestLine, s)
+	}
+
+	switch {
+	case method == "CONNECT":
+		host, port, ok := strings.Cut(s, ":")
+		if !ok || host == "" || port == "" || strings.ContainsAny(s, "/?@") {
+			return Target{}, fmt.Errorf("%w: CONNECT needs a host:port target: %s", ErrInvalidRequestLine, s)
+		}
+		return Target{Form: AuthorityForm, Host: s}, nil
+	case s == "*":
+		if method != "OPTIONS" {
+			return Target{}, fmt.Errorf("%w: * target is only allowed for OPTIONS", ErrInvalidRequestLine)
+		}
+		return Target{Form: AsteriskForm, Path: "*", RawPath: "*"}, nil
+	case strings.HasPrefix(s, "/"):
+		return parseOriginForm(s)
+	}
+
+	scheme, rest, ok := strings.Cut(s, "://")
+	if !ok || !isScheme(scheme) {
+		return Target{}, fmt.Errorf("%w: invalid request target: %s", ErrInvalidRequestLine, s)
+	}
+	end := strings.IndexAny(rest, "/?")
+	if end == -1 {
+		end = len(rest)
+	}
+	host := rest[:end]
+	if host == "" || strings.Contains(host, "@") {
+		return Target{}, fmt.Errorf("%w: invalid host in request target: %s", ErrInvalidRequestLine, s)
+	}
+	// An empty path in absolute-form stands for /
+	origin := rest[end:]
+	if !strings.HasPrefix(origin, "/") {
+		origin = "/" + origin
+	}
+	t, err := parseOriginForm(origin)
+	if err != nil {
+		return Target{}, err
+	}
+	t.Form = AbsoluteForm
+	t.Scheme = strings.ToLower(scheme)
+	t.Host = host
+	return t, nil
+}
+
+func parseOriginForm(s string) (Target, error) {
+	rawPath, rawQuery, _ := strings.Cut(s, "?")
+	p, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return Target{}, fmt.Errorf("%w: invalid path escape: %s", ErrInvalidRequestLine, rawPath)
+	}
+	return Target{Form: OriginForm, Path: p, RawPath: rawPath, RawQuery: rawQuery}, nil
+}
+
+func isScheme(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !isLetter && (i == 0 || !(c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.')) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+package response
+
+import (
+	"fmt"
+	"http/internal/headers"
+	"slices"
+	"strings"
+)
+
+// Fields that can't be sent as trailers since they are needed to frame,
+// route or authenticate the message before the body is read.
+var forbiddenTrailers = map[string]bool{
+	"content-length":    true,
+	"transfer-encoding": true,
+	"content-encoding":  true,
+	"content-type":      true,
+	"content-range":     true,
+	"trailer":           true,
+	"host":              true,
+	"authorization":     true,
+	"set-cookie":        true,
+	"cache-control":     true,
+	"connection":        true,
+}
+
+// WriteChunkedBody writes p as a single chunk. The headers must have set
+// transfer-encoding: chunked. Writing an empty p is a no-op since a zero
+// length chunk ends the body.
+func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
+	if w.state != stateHeadersWritten || !w.chunked {
+		return 0, fmt.Errorf("writer not in proper state")
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(p)
+	}
+	return w.writeChunk(p)
+}
+
+func (w *Writer) writeChunk(p []byte) (int, error) {
+	if w.suppressBody {
+		return len(p), nil
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if _, err := fmt.Fprintf(w.W, "%x\r\n", len(p)); err != nil {
+		return 0, err
+	}
+	n, err := w.W.Write(p)
+	if err != nil {
+		return n, err
+	}
+	_, err = w.W.Write([]byte("\r\n"))
+	return n, err
+}
+
+// WriteChunkedBodyDone ends a chunked body that has no trailers.
+func (w *Writer) WriteChunkedBodyDone() (int, error) {
+	if w.state != stateHeadersWritten || !w.chunked {
+		return 0, fmt.Errorf("writer not in proper state")
+	}
+	if err := w.finishEncoding(); err != nil {
+		return 0, err
+	}
+	w.state = stateBodyWritten
+	if w.suppressBody {
+		return 0, nil
+	}
+	return w.W.Write([]byte("0\r\n\r\n"))
+}
+
+// WriteTrailers ends a chunked body with trailer fields. Every field must have
+// been announced in the trailer header of the response.
+func (w *Writer) WriteTrailers(h *headers.Headers) error {
+	if w.state != stateHeadersWritten || !w.chunked {
+		return fmt.Errorf("writer not in proper state")
+	}
+	for _, f := range h.Fields() {
+		name := strings.ToLower(f.Name)
+		if forbiddenTrailers[name] {
+			return fmt.Errorf("field not allowed in trailers: %s", f.Name)
+		}
+		if !slices.Contains(w.trailers, name) {
+			return fmt.Errorf("trailer not announced in trailer header: %s", f.Name)
+		}
+	}
+	if err := w.finishEncoding(); err != nil {
+		return err
+	}
+	w.state = stateBodyWritten
+	if w.suppressBody {
+		return nil
+	}
+	if _, err := w.W.Write([]byte("0\r\n")); err != nil {
+		return err
+	}
+	return w.writeFields(h)
+}
+
+// ChunkedWriter is an io.WriteCloser over a chunked response body, writing
+// each call to Write as one chunk.
+type ChunkedWriter struct {
+	w *Writer
+}
+
+// ChunkedBody returns a stream for the body once headers with
+// transfer-encoding: chunked have been written.
+func (w *Writer) ChunkedBody() *ChunkedWriter {
+	return &ChunkedWriter{w: w}
+}
+
+func (cw *ChunkedWriter) Write(p []byte) (int, error) {
+	return cw.w.WriteChunkedBody(p)
+}
+
+// Close ends the body without trailers.
+func (cw *ChunkedWriter) Close() error {
+	_, err := cw.w.WriteChunkedBodyDone()
+	return err
+}
+
+// CloseWithTrailers ends the body with the given trailer fields.
+func (cw *ChunkedWriter) CloseWithTrailers(h *headers.Headers) error {
+	return cw.w.WriteTrailers(h)
+}
@@ -0,0 +1,191 @@
+package response
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"http/internal/headers"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// minCompressSize is the smallest body worth compressing. Below it the
+// encoding overhead can outweigh the savings.
+const minCompressSize = 256
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+type encoding struct {
+	name string
+	pool sync.Pool
+}
+
+// Supported encodings in order of preference when the client likes several
+// of them equally. deflate in HTTP means the zlib format.
+var encodings = []*encoding{
+	{name: "gzip", pool: sync.Pool{New: func() any { return gzip.NewWriter(nil) }}},
+	{name: "deflate", pool: sync.Pool{New: func() any { return zlib.NewWriter(nil) }}},
+}
+
+// Content types that are compressed already, so compressing them again only
+// costs time.
+var incompressibleTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/pdf",
+	"application/octet-stream",
+	"multipart/byteranges",
+}
+
+// HandleCompression makes the response body go out compressed with gzip or
+// deflate, whichever the accept-encoding header of the request prefers. The
+// body is then sent chunked. Responses that are small, have no body, are
+// encoded already or have a content type that doesn't compress are sent
+// as is.
+func (w *Writer) HandleCompression(reqHeaders *headers.Headers) {
+	w.compress = true
+	w.acceptEncoding, _ = reqHeaders.Get("accept-encoding")
+}
+
+// startEncoding is run by WriteHeaders to decide whether the body gets
+// compressed, adjusting the headers to match if it does.
+func (w *Writer) startEncoding(h *headers.Headers) {
+	notModified := w.statusCode == StatusCode304
+	if (isBodyless(w.statusCode) && !notModified) || w.statusCode == StatusCode206 || h.Has("content-encoding") || h.HasToken("cache-control", "no-transform") {
+		return
+	}
+	// A 304 carries the vary and etag of the 200 it stands for
+	if notModified {
+		addVary(h)
+		if negotiateEncoding(w.acceptEncoding) != nil {
+			weakenETag(h)
+		}
+		return
+	}
+	contentType, _ := h.Get("content-type")
+	contentType = strings.ToLower(contentType)
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(contentType, prefix) && !strings.HasPrefix(contentType, "image/svg") {
+			return
+		}
+	}
+	if val, ok := h.Get("content-length"); ok {
+		if n, err := strconv.Atoi(val); err == nil && n < minCompressSize {
+			return
+		}
+	}
+
+	addVary(h)
+	enc := negotiateEncoding(w.acceptEncoding)
+	if enc == nil {
+		return
+	}
+	h.Set("content-encoding", enc.name)
+	h.Del("content-length")
+	if !h.HasToken("transfer-encoding", "chunked") {
+		h.Set("transfer-encoding", "chunked")
+	}
+	weakenETag(h)
+	// A HEAD response gets the headers of the compressed GET but has no
+	// body to encode
+	if w.suppressBody {
+		return
+	}
+
+	e := enc.pool.Get().(encoder)
+	e.Reset(chunkWriter{w})
+	w.encoder = e
+	w.encoding = enc
+}
+
+// addVary marks the response as depending on accept-encoding.
+func addVary(h *headers.Headers) {
+	if !h.HasToken("vary", "accept-encoding") && !h.HasToken("vary", "*") {
+		h.Add("vary", "Accept-Encoding")
+	}
+}
+
+// weakenETag marks the etag weak, since the compressed bytes differ from the
+// original and a strong etag no longer holds.
+func weakenETag(h *headers.Headers) {
+	if etag, ok := h.Get("etag"); ok && !strings.HasPrefix(etag, "W/") {
+		h.Set("etag", "W/"+etag)
+	}
+}
+
+// finishEncoding writes out whatever the encoder still holds and returns it
+// to its pool.
+func (w *Writer) finishEncoding() error {
+	if w.encoder == nil {
+		return nil
+	}
+	err := w.encoder.Close()
+	w.encoding.pool.Put(w.encoder)
+	w.encoder = nil
+	return err
+}
+
+// negotiateEncoding picks the supported encoding with the highest q-value in
+// accept-encoding, or nil if the client accepts none of them.
+func negotiateEncoding(acceptEncoding string) *encoding {
+	q := make(map[string]float64)
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(item, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if name == "x-gzip" {
+			name = "gzip"
+		}
+		q[name] = parseQ(params)
+	}
+	var best *encoding
+	bestQ := 0.0
+	for _, enc := range encodings {
+		encQ, ok := q[enc.name]
+		if !ok {
+			encQ, ok = q["*"]
+		}
+		if ok && encQ > bestQ {
+			best, bestQ = enc, encQ
+		}
+	}
+	return best
+}
+
+// parseQ returns the q parameter of an accept-encoding item, 1 if it has
+// none and 0 if it isn't valid.
+func parseQ(params string) float64 {
+	for _, param := range strings.Split(params, ";") {
+		key, val, _ := strings.Cut(param, "=")
+		if !strings.EqualFold(strings.TrimSpace(key), "q") {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if err != nil || q < 0 || q > 1 {
+			return 0
+		}
+		return q
+	}
+	return 1
+}
+
+// chunkWriter sends what the encoder produces as chunks of the body.
+type chunkWriter struct {
+	w *Writer
+}
+
+func (cw chunkWriter) Write(p []byte) (int, error) {
+	return cw.w.writeChunk(p)
+}
@@ -0,0 +1,179 @@
+package response
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+	"testing"
+
+	"http/internal/headers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"br, deflate", "deflate"},
+		{"deflate, gzip", "gzip"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"gzip; q=0, deflate;q=0", ""},
+		{"*", "gzip"},
+		{"*;q=0.1, gzip;q=0", "deflate"},
+		{"GZIP;Q=0.8", "gzip"},
+		{"x-gzip", "gzip"},
+		{"gzip;q=2", ""},
+		{"identity", ""},
+	}
+	for _, tc := range tests {
+		got := ""
+		if enc := negotiateEncoding(tc.acceptEncoding); enc != nil {
+			got = enc.name
+		}
+		assert.Equal(t, tc.want, got, tc.acceptEncoding)
+	}
+}
+
+// compressed runs respond against a writer handling compression for a request
+// with the given accept-encoding and parses what it wrote.
+func compressed(t *testing.T, acceptEncoding string, respond func(w *Writer)) *Response {
+	h := headers.NewHeaders()
+	h.Set("accept-encoding", acceptEncoding)
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.HandleCompression(h)
+	respond(w)
+	require.NoError(t, w.Finish())
+	resp, err := ResponseFromReader(&buf)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestCompression(t *testing.T) {
+	body := strings.Repeat("<p>hello world</p>\n", 1000)
+	writeHTML := func(w *Writer) {
+		w.Header().Set("content-type", "text/html")
+		w.Header().Set("etag", `"v1"`)
+		w.Write([]byte(body))
+	}
+
+	resp := compressed(t, "gzip, deflate", writeHTML)
+	assert.Equal(t, StatusCode200, resp.StatusLine.StatusCode)
+	assert.Equal(t, "gzip", get(resp.Headers, "content-encoding"))
+	assert.Equal(t, "chunked", get(resp.Headers, "transfer-encoding"))
+	assert.Equal(t, "Accept-Encoding", get(resp.Headers, "vary"))
+	assert.Equal(t, `W/"v1"`, get(resp.Headers, "etag"))
+	assert.False(t, resp.Headers.Has("content-length"))
+	assert.Less(t, len(resp.Body), len(body))
+	zr, err := gzip.NewReader(bytes.NewReader(resp.Body))
+	require.NoError(t, err)
+	got, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(got))
+
+	resp = compressed(t, "deflate", writeHTML)
+	assert.Equal(t, "deflate", get(resp.Headers, "content-encoding"))
+	zr2, err := zlib.NewReader(bytes.NewReader(resp.Body))
+	require.NoError(t, err)
+	got, err = io.ReadAll(zr2)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(got))
+
+	// The response still varies on accept-encoding when it isn't compressed
+	resp = compressed(t, "", writeHTML)
+	assert.False(t, resp.Headers.Has("content-encoding"))
+	assert.Equal(t, "Accept-Encoding", get(resp.Headers, "vary"))
+	assert.Equal(t, `"v1"`, get(resp.Headers, "etag"))
+	assert.Equal(t, body, string(resp.Body))
+
+	// Small bodies, compressed types and bodyless responses are sent as is
+	resp = compressed(t, "gzip", func(w *Writer) {
+		w.Write([]byte("short"))
+	})
+	assert.False(t, resp.Headers.Has("content-encoding"))
+	assert.False(t, resp.Headers.Has("vary"))
+	assert.Equal(t, "short", string(resp.Body))
+
+	resp = compressed(t, "gzip", func(w *Writer) {
+		w.Header().Set("content-type", "video/mp4")
+		w.Write([]byte(body))
+	})
+	assert.False(t, resp.Headers.Has("content-encoding"))
+	assert.Equal(t, body, string(resp.Body))
+
+	resp = compressed(t, "gzip", func(w *Writer) {
+		w.Header().Set("content-encoding", "br")
+		w.Write([]byte(body))
+	})
+	assert.Equal(t, "br", get(resp.Headers, "content-encoding"))
+	assert.Equal(t, body, string(resp.Body))
+
+	resp = compressed(t, "gzip", func(w *Writer) {
+		w.WriteHeader(StatusCode204)
+	})
+	assert.Equal(t, StatusCode204, resp.StatusLine.StatusCode)
+	assert.False(t, resp.Headers.Has("content-encoding"))
+
+	// A 304 has the vary and etag the compressed 200 would have had
+	notModified := func(w *Writer) {
+		w.Header().Set("etag", `"v1"`)
+		w.WriteHeader(StatusCode304)
+	}
+	resp = compressed(t, "gzip", notModified)
+	assert.Equal(t, StatusCode304, resp.StatusLine.StatusCode)
+	assert.Equal(t, "Accept-Encoding", get(resp.Headers, "vary"))
+	assert.Equal(t, `W/"v1"`, get(resp.Headers, "etag"))
+	assert.False(t, resp.Headers.Has("content-encoding"))
+
+	resp = compressed(t, "", notModified)
+	assert.Equal(t, "Accept-Encoding", get(resp.Headers, "vary"))
+	assert.Equal(t, `"v1"`, get(resp.Headers, "etag"))
+}
+
+func TestCompressionLowLevel(t *testing.T) {
+	body := strings.Repeat("a", 1000)
+
+	// A content-length body written directly is switched to chunked
+	resp := compressed(t, "gzip", func(w *Writer) {
+		require.NoError(t, w.WriteStatusLine(StatusCode200))
+		require.NoError(t, w.WriteHeaders(GetDefaultHeaders(len(body))))
+		_, err := w.WriteBody([]byte(body))
+		require.NoError(t, err)
+	})
+	assert.Equal(t, "gzip", get(resp.Headers, "content-encoding"))
+	zr, err := gzip.NewReader(bytes.NewReader(resp.Body))
+	require.NoError(t, err)
+	got, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(got))
+
+	// Streamed chunks are flushed through the encoder and trailers still follow
+	resp = compressed(t, "gzip", func(w *Writer) {
+		h := headers.NewHeaders()
+		h.Set("transfer-encoding", "chunked")
+		h.Set("trailer", "x-done")
+		require.NoError(t, w.WriteStatusLine(StatusCode200))
+		require.NoError(t, w.WriteHeaders(h))
+		cw := w.ChunkedBody()
+		cw.Write([]byte(body))
+		require.NoError(t, cw.Flush())
+		cw.Write([]byte(body))
+		trailers := headers.NewHeaders()
+		trailers.Set("x-done", "yes")
+		require.NoError(t, cw.CloseWithTrailers(trailers))
+	})
+	assert.Equal(t, "yes", get(resp.Trailers, "x-done"))
+	zr, err = gzip.NewReader(bytes.NewReader(resp.Body))
+	require.NoError(t, err)
+	got, err = io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, body+body, string(got))
+}
@@ -0,0 +1,189 @@
+package response
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"http/internal/headers"
+	"strings"
+	"time"
+)
+
+// TimeFormat is the HTTP-date format used by last-modified and friends.
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// Obsolete HTTP-date formats that recipients still have to accept.
+var timeFormats = []string{
+	TimeFormat,
+	"Monday, 02-Jan-06 15:04:05 GMT",
+	"Mon Jan _2 15:04:05 2006",
+}
+
+// ParseTime parses an HTTP-date in any of the formats RFC 9110 allows.
+func ParseTime(s string) (time.Time, error) {
+	for _, layout := range timeFormats {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid HTTP-date: %s", s)
+}
+
+// ETag returns a strong entity tag for a body held in memory.
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// FileETag returns an entity tag for a file that changes whenever its size or
+// modification time does.
+func FileETag(size int64, modtime time.Time) string {
+	return fmt.Sprintf(`"%x-%x"`, modtime.UnixNano(), size)
+}
+
+// CheckPreconditions evaluates the conditional headers of a request against
+// the current etag and modification time of the target, either of which may
+// be empty. It returns 304 or 412 if the request should be answered with that
+// status instead, or 0 to carry on. The headers are checked in the order RFC
+// 9110 section 13.2.2 gives, so if-match and if-none-match take precedence
+// over the date based conditions they replace.
+func CheckPreconditions(h *headers.Headers, method, etag string, modtime time.Time) StatusCode {
+	if ifMatch, ok := h.Get("if-match"); ok {
+		if !matchETag(ifMatch, etag, false) {
+			return StatusCode412
+		}
+	} else if since, ok := headerTime(h, "if-unmodified-since"); ok && !modtime.IsZero() {
+		if truncate(modtime).After(since) {
+			return StatusCode412
+		}
+	}
+
+	safe := method == "GET" || method == "HEAD"
+	if ifNoneMatch, ok := h.Get("if-none-match"); ok {
+		if matchETag(ifNoneMatch, etag, true) {
+			if safe {
+				return StatusCode304
+			}
+			return StatusCode412
+		}
+	} else if since, ok := headerTime(h, "if-modified-since"); ok && safe && !modtime.IsZero() {
+		if !truncate(modtime).After(since) {
+			return StatusCode304
+		}
+	}
+	return 0
+}
+
+// HandleConditional makes a buffered 200 response answer the conditional
+// headers of the request it is for. When the handler is done, the body gets
+// an etag unless one was set, and the response turns into a 304 or 412 if the
+// preconditions say so. Without an etag set, a 200 body is held in memory
+// until the handler returns, however long it is, so one can be worked out.
+// Responses already sent are left alone.
+func (w *Writer) HandleConditional(method string, reqHeaders *headers.Headers) {
+	w.conditionalMethod = method
+	w.conditionalHeaders = reqHeaders
+}
+
+// applyConditional is run by Finish on a response that is still buffered.
+func (w *Writer) applyConditional() {
+	if w.conditionalHeaders == nil || w.pendingStatus != StatusCode200 {
+		return
+	}
+	etag, ok := w.header.Get("etag")
+	if !ok {
+		etag = ETag(w.pendingBody)
+		w.header.Set("etag", etag)
+	}
+	var modtime time.Time
+	if lastModified, ok := w.header.Get("last-modified"); ok {
+		modtime, _ = ParseTime(lastModified)
+	}
+	switch CheckPreconditions(w.conditionalHeaders, w.conditionalMethod, etag, modtime) {
+	case StatusCode304:
+		w.NotModified()
+	case StatusCode412:
+		// The body is dropped, so headers framing it no longer apply
+		for _, name := range []string{"content-length", "content-encoding", "transfer-encoding", "trailer"} {
+			w.header.Del(name)
+		}
+		w.pendingStatus = StatusCode412
+		w.pendingBody = nil
+	}
+}
+
+// NotModified sets up a 304 response, dropping headers that describe a body
+// since a 304 doesn't carry one. Validators and caching headers are kept.
+func (w *Writer) NotModified() error {
+	for _, name := range []string{"content-type", "content-length", "content-encoding", "content-range", "transfer-encoding", "trailer"} {
+		w.header.Del(name)
+	}
+	w.pendingStatus = 0
+	w.pendingBody = nil
+	return w.WriteHeader(StatusCode304)
+}
+
+// matchETag reports whether etag is in the list of entity tags, or the list
+// is * and the target exists. Weak comparison ignores the W/ prefix, strong
+// comparison never matches a weak tag.
+func matchETag(list, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	current, currentWeak := strings.CutPrefix(etag, "W/")
+	if currentWeak && !weak {
+		return false
+	}
+	for _, tag := range parseETags(list) {
+		opaque, isWeak := strings.CutPrefix(tag, "W/")
+		if isWeak && !weak {
+			continue
+		}
+		if opaque == current {
+			return true
+		}
+	}
+	return false
+}
+
+// parseETags splits a comma separated list of entity tags. Commas are allowed
+// inside the quotes, so the list can't simply be split on them.
+func parseETags(list string) []string {
+	var tags []string
+	for {
+		list = strings.TrimLeft(list, " \t,")
+		if list == "" {
+			return tags
+		}
+		prefix := ""
+		if strings.HasPrefix(list, "W/") {
+			prefix, list = "W/", list[2:]
+		}
+		if !strings.HasPrefix(list, `"`) {
+			return tags
+		}
+		end := strings.IndexByte(list[1:], '"')
+		if end == -1 {
+			return tags
+		}
+		tags = append(tags, prefix+list[:end+2])
+		list = list[end+2:]
+	}
+}
+
+func headerTime(h *headers.Headers, key string) (time.Time, bool) {
+	val, ok := h.Get(key)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := ParseTime(val)
+	return t, err == nil
+}
+
+// truncate drops the sub-second part HTTP-dates can't express.
+func truncate(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
@@ -0,0 +1,159 @@
+package response
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"http/internal/headers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(1994, 11, 6, 8, 49, 37, 0, time.UTC)
+	for _, s := range []string{
+		"Sun, 06 Nov 1994 08:49:37 GMT",
+		"Sunday, 06-Nov-94 08:49:37 GMT",
+		"Sun Nov  6 08:49:37 1994",
+	} {
+		got, err := ParseTime(s)
+		require.NoError(t, err, s)
+		assert.True(t, want.Equal(got), s)
+	}
+	_, err := ParseTime("yesterday")
+	assert.Error(t, err)
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	modtime := time.Date(2024, 3, 1, 12, 0, 0, 500, time.UTC)
+	const (
+		before = "Thu, 29 Feb 2024 12:00:00 GMT"
+		at     = "Fri, 01 Mar 2024 12:00:00 GMT"
+	)
+	tests := []struct {
+		name   string
+		method string
+		fields map[string]string
+		etag   string
+		want   StatusCode
+	}{
+		{"no conditions", "GET", nil, `"a"`, 0},
+		{"if-match hit", "PUT", map[string]string{"if-match": `"x", "a"`}, `"a"`, 0},
+		{"if-match miss", "PUT", map[string]string{"if-match": `"x"`}, `"a"`, StatusCode412},
+		{"if-match star", "PUT", map[string]string{"if-match": "*"}, `"a"`, 0},
+		{"if-match star no target", "PUT", map[string]string{"if-match": "*"}, "", StatusCode412},
+		{"if-match is strong", "PUT", map[string]string{"if-match": `W/"a"`}, `W/"a"`, StatusCode412},
+		{"if-unmodified-since passes", "PUT", map[string]string{"if-unmodified-since": at}, `"a"`, 0},
+		{"if-unmodified-since fails", "PUT", map[string]string{"if-unmodified-since": before}, `"a"`, StatusCode412},
+		{"if-match beats if-unmodified-since", "PUT", map[string]string{"if-match": `"a"`, "if-unmodified-since": before}, `"a"`, 0},
+		{"if-none-match hit", "GET", map[string]string{"if-none-match": `"x", W/"a"`}, `"a"`, StatusCode304},
+		{"if-none-match hit on head", "HEAD", map[string]string{"if-none-match": `"a"`}, `"a"`, StatusCode304},
+		{"if-none-match hit on put", "PUT", map[string]string{"if-none-match": "*"}, `"a"`, StatusCode412},
+		{"if-none-match miss", "GET", map[string]string{"if-none-match": `"x"`}, `"a"`, 0},
+		{"if-modified-since unchanged", "GET", map[string]string{"if-modified-since": at}, `"a"`, StatusCode304},
+		{"if-modified-since changed", "GET", map[string]string{"if-modified-since": before}, `"a"`, 0},
+		{"if-modified-since ignored for post", "POST", map[string]string{"if-modified-since": at}, `"a"`, 0},
+		{"if-none-match beats if-modified-since", "GET", map[string]string{"if-none-match": `"x"`, "if-modified-since": at}, `"a"`, 0},
+		{"bad date ignored", "GET", map[string]string{"if-modified-since": "soon"}, `"a"`, 0},
+		{"if-match checked first", "GET", map[string]string{"if-match": `"x"`, "if-none-match": `"a"`}, `"a"`, StatusCode412},
+	}
+	for _, tc := range tests {
+		h := headers.NewHeaders()
+		for k, v := range tc.fields {
+			h.Set(k, v)
+		}
+		assert.Equal(t, tc.want, CheckPreconditions(h, tc.method, tc.etag, modtime), tc.name)
+	}
+}
+
+func TestHandleConditional(t *testing.T) {
+	respond := func(method string, fields map[string]string) string {
+		h := headers.NewHeaders()
+		for k, v := range fields {
+			h.Set(k, v)
+		}
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.HandleConditional(method, h)
+		w.Header().Set("content-type", "text/plain")
+		w.Write([]byte("hello"))
+		require.NoError(t, w.Finish())
+		return buf.String()
+	}
+	etag := ETag([]byte("hello"))
+
+	out := respond("GET", nil)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"content-type: text/plain\r\n"+
+		"etag: "+etag+"\r\n"+
+		"content-length: 5\r\n"+
+		"connection: close\r\n"+
+		"\r\n"+
+		"hello", out)
+
+	out = respond("GET", map[string]string{"if-none-match": etag})
+	assert.Equal(t, "HTTP/1.1 304 Not Modified\r\n"+
+		"etag: "+etag+"\r\n"+
+		"connection: close\r\n"+
+		"\r\n", out)
+
+	out = respond("PUT", map[string]string{"if-match": `"stale"`})
+	assert.Equal(t, "HTTP/1.1 412 Precondition Failed\r\n"+
+		"content-type: text/plain\r\n"+
+		"etag: "+etag+"\r\n"+
+		"content-length: 0\r\n"+
+		"connection: close\r\n"+
+		"\r\n", out)
+
+	// A content-length set for the dropped body isn't sent with the 412
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetKeepAlive(true)
+	h := headers.NewHeaders()
+	h.Set("if-match", `"nope"`)
+	w.HandleConditional("PUT", h)
+	w.Header().Set("content-length", "5")
+	w.Write([]byte("hello"))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 412 Precondition Failed\r\n"+
+		"etag: "+etag+"\r\n"+
+		"content-length: 0\r\n"+
+		"connection: keep-alive\r\n"+
+		"\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Bodies too long to buffer otherwise are held back in full
+	long := strings.Repeat("a", 5000)
+	h = headers.NewHeaders()
+	h.Set("if-none-match", ETag([]byte(long)))
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.HandleConditional("GET", h)
+	w.Write([]byte(long[:3000]))
+	w.Write([]byte(long[3000:]))
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 304 Not Modified\r\n"))
+
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.HandleConditional("GET", headers.NewHeaders())
+	w.Write([]byte(long))
+	require.NoError(t, w.Finish())
+	resp, err := ResponseFromReader(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "5000", get(resp.Headers, "content-length"))
+	assert.Equal(t, long, string(resp.Body))
+
+	// Only 200 responses are conditional
+	buf.Reset()
+	w = NewWriter(&buf)
+	h = headers.NewHeaders()
+	h.Set("if-none-match", "*")
+	w.HandleConditional("GET", h)
+	w.WriteHeader(StatusCode404)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\ncontent-length: 0\r\nconnection: close\r\n\r\n", buf.String())
+}
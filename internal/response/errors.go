@@ -0,0 +1,18 @@
+package response
+
+import (
+	"errors"
+	"http/internal/framing"
+)
+
+// Parse errors returned by ReadResponse. They are wrapped with details about
+// the offending input, so use errors.Is to tell them apart.
+var (
+	ErrInvalidStatusLine    = errors.New("invalid status line")
+	ErrStatusLineTooLong    = errors.New("status line too long")
+	ErrUnsupportedVersion   = errors.New("unsupported HTTP version")
+	ErrInvalidContentLength = framing.ErrInvalidContentLength
+	ErrInvalidFraming       = framing.ErrInvalidFraming
+	ErrUnsupportedEncoding  = framing.ErrUnsupportedEncoding
+	ErrInvalidChunk         = framing.ErrInvalidChunk
+)
@@ -0,0 +1,43 @@
+package response
+
+import (
+	"bufio"
+	"io"
+)
+
+// NewBufferedWriter returns a Writer that collects output in a buffer so the
+// status line, headers and small bodies go out in as few writes to w as
+// possible. Nothing reaches w until the buffer fills or Flush is called.
+func NewBufferedWriter(w io.Writer) *Writer {
+	return NewWriter(bufio.NewWriter(w))
+}
+
+// Flush sends everything written so far to the client. A response started
+// with WriteHeader or Write is committed first; with no content-length set its
+// body is switched to chunked encoding since its length isn't known yet.
+// Streaming handlers call it after each piece of output they want delivered
+// right away.
+func (w *Writer) Flush() error {
+	if w.state == stateInitial && w.pendingStatus != 0 {
+		if !w.header.Has("content-length") && !isBodyless(w.pendingStatus) {
+			w.header.Set("transfer-encoding", "chunked")
+		}
+		if err := w.commit(); err != nil {
+			return err
+		}
+	}
+	if w.encoder != nil {
+		if err := w.encoder.Flush(); err != nil {
+			return err
+		}
+	}
+	if f, ok := w.W.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Flush sends the chunks written so far to the client.
+func (cw *ChunkedWriter) Flush() error {
+	return cw.w.Flush()
+}
@@ -0,0 +1,265 @@
+package response
+
+import (
+	"bytes"
+	"fmt"
+	"http/internal/framing"
+	"http/internal/headers"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Response is a response parsed off a connection by a Reader.
+type Response struct {
+	StatusLine StatusLine
+	Headers    *headers.Headers
+	// Body is only populated once BufferBody has been called.
+	Body []byte
+	// BodyReader streams the body off the connection as it is read.
+	BodyReader io.ReadCloser
+	// Trailers is populated once a chunked body has been read to the end.
+	Trailers *headers.Headers
+	// ContentLength is the size of the body, or -1 if it is chunked or runs
+	// until the connection is closed.
+	ContentLength int64
+	// Close reports whether the server will close the connection after this
+	// response, either because it said so or because the body runs until the
+	// connection closes.
+	Close bool
+
+	state       parserState
+	headerBytes int
+}
+
+type StatusLine struct {
+	HttpVersion  string
+	StatusCode   StatusCode
+	ReasonPhrase string
+}
+
+type parserState int
+
+const (
+	SEPARATOR = "\r\n"
+
+	stateParsingStatusLine = 0
+	stateParsingHeaders    = 1
+	stateDone              = 2
+
+	maxStatusLineBytes = 8 << 10
+	maxHeaderBytes     = 1 << 20
+)
+
+// Reader parses successive responses off a single connection, keeping any
+// bytes read past the end of one response for the next.
+type Reader struct {
+	conn *framing.Conn
+	body *framing.Body
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{conn: framing.NewConn(reader)}
+}
+
+// ResponseFromReader reads a single response to a GET and buffers its body
+// into Body.
+func ResponseFromReader(reader io.Reader) (*Response, error) {
+	resp, err := NewReader(reader).ReadResponse("GET")
+	if err != nil {
+		return nil, err
+	}
+	if err := resp.BufferBody(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ReadResponse parses the status line and headers of the response to a
+// request made with method, skipping interim 1xx responses, and returns with
+// the body left unread on BodyReader. Any unread body of the previous response
+// is discarded first. It returns io.EOF if the connection is closed before any
+// bytes of a new response arrive.
+func (rr *Reader) ReadResponse(method string) (*Response, error) {
+	if err := rr.discardBody(); err != nil {
+		return nil, err
+	}
+
+	for {
+		resp := &Response{
+			state:    stateParsingStatusLine,
+			Headers:  headers.NewHeaders(),
+			Trailers: headers.NewHeaders(),
+		}
+		for resp.state != stateDone {
+			if err := rr.advance(resp); err != nil {
+				return nil, err
+			}
+		}
+		code := resp.StatusLine.StatusCode
+		if code/100 == 1 && code != StatusCode101 {
+			continue
+		}
+
+		body, err := rr.newBody(resp, method == "HEAD")
+		if err != nil {
+			return nil, err
+		}
+		rr.body = body
+		resp.BodyReader = body
+		return resp, nil
+	}
+}
+
+// newBody works out how the body of resp is framed, setting ContentLength and
+// Close to match.
+func (rr *Reader) newBody(resp *Response, noBody bool) (*framing.Body, error) {
+	resp.setClose()
+	resp.ContentLength = -1
+	code := resp.StatusLine.StatusCode
+	if noBody || code/100 == 1 || code == StatusCode204 || code == StatusCode304 {
+		// A HEAD response describes the body a GET would have had
+		resp.ContentLength = 0
+		sizeVal, _ := resp.Headers.Get("content-length")
+		if n, err := strconv.ParseInt(sizeVal, 10, 64); noBody && err == nil && n >= 0 {
+			resp.ContentLength = n
+		}
+		return framing.NewLengthBody(rr.conn, 0), nil
+	}
+	length, chunked, err := framing.Length(resp.Headers)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case chunked:
+		return framing.NewChunkedBody(rr.conn, framing.Chunked{
+			ParseTrailer: func(data []byte) (int, bool, error) {
+				return resp.parseFieldLine(resp.Trailers, data)
+			},
+		}), nil
+	case length < 0:
+		resp.Close = true
+		return framing.NewCloseDelimitedBody(rr.conn), nil
+	default:
+		resp.ContentLength = length
+		return framing.NewLengthBody(rr.conn, length), nil
+	}
+}
+
+func (rr *Reader) discardBody() error {
+	if rr.body == nil {
+		return nil
+	}
+	err := rr.body.Close()
+	rr.body = nil
+	return err
+}
+
+// BufferBody reads the rest of the body into Body and replaces BodyReader
+// with a reader over the buffered bytes.
+func (r *Response) BufferBody() error {
+	data, err := io.ReadAll(r.BodyReader)
+	if err != nil {
+		return err
+	}
+	r.Body = data
+	r.BodyReader = io.NopCloser(bytes.NewReader(data))
+	return nil
+}
+
+// advance feeds buffered data to the parser, reading more from the
+// connection until the parser makes progress.
+func (rr *Reader) advance(resp *Response) error {
+	err := rr.conn.Next(resp.parse)
+	if err == io.EOF && (resp.state != stateParsingStatusLine || len(rr.conn.Buffered()) > 0) {
+		return fmt.Errorf("%w while reading response", io.ErrUnexpectedEOF)
+	}
+	return err
+}
+
+func parseStatusLine(data []byte) (*StatusLine, int, error) {
+	endIdx := bytes.Index(data, []byte(SEPARATOR))
+	if endIdx > maxStatusLineBytes || (endIdx == -1 && len(data) > maxStatusLineBytes) {
+		return nil, 0, ErrStatusLineTooLong
+	}
+	if endIdx == -1 {
+		return nil, 0, nil
+	}
+	line := string(data[:endIdx])
+
+	// The reason phrase may contain spaces or be left out entirely
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 {
+		return nil, 0, fmt.Errorf("%w: %s", ErrInvalidStatusLine, line)
+	}
+	version, ok := strings.CutPrefix(parts[0], "HTTP/")
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: %s", ErrInvalidStatusLine, line)
+	}
+	if version != "1.1" && version != "1.0" {
+		return nil, 0, fmt.Errorf("%w: %s", ErrUnsupportedVersion, version)
+	}
+	code, err := strconv.Atoi(parts[1])
+	if err != nil || len(parts[1]) != 3 || !StatusCode(code).Valid() {
+		return nil, 0, fmt.Errorf("%w: bad status code %s", ErrInvalidStatusLine, parts[1])
+	}
+	statusLine := &StatusLine{
+		HttpVersion: version,
+		StatusCode:  StatusCode(code),
+	}
+	if len(parts) == 3 {
+		statusLine.ReasonPhrase = parts[2]
+	}
+	return statusLine, endIdx + len(SEPARATOR), nil
+}
+
+func (r *Response) parse(data []byte) (int, error) {
+	switch r.state {
+	case stateDone:
+		return 0, fmt.Errorf("response already parsed")
+	case stateParsingStatusLine:
+		statusLine, bytesRead, err := parseStatusLine(data)
+		if err != nil || bytesRead == 0 {
+			return 0, err
+		}
+		r.StatusLine = *statusLine
+		r.state = stateParsingHeaders
+		return bytesRead, nil
+	case stateParsingHeaders:
+		bytesRead, done, err := r.parseFieldLine(r.Headers, data)
+		if err != nil {
+			return 0, err
+		}
+		if !done {
+			return bytesRead, nil
+		}
+		r.state = stateDone
+		return bytesRead, nil
+	default:
+		return 0, fmt.Errorf("invalid state: %d", r.state)
+	}
+}
+
+// setClose works out from the version and connection header whether the
+// server keeps the connection open after this response.
+func (r *Response) setClose() {
+	if r.StatusLine.HttpVersion == "1.0" {
+		r.Close = !r.Headers.HasToken("connection", "keep-alive")
+	} else {
+		r.Close = r.Headers.HasToken("connection", "close")
+	}
+}
+
+// parseFieldLine parses a header or trailer line into h, enforcing the header
+// size limit across both.
+func (r *Response) parseFieldLine(h *headers.Headers, data []byte) (int, bool, error) {
+	bytesRead, done, err := h.Parse(data)
+	if err != nil {
+		return 0, false, err
+	}
+	r.headerBytes += bytesRead
+	if r.headerBytes > maxHeaderBytes || (bytesRead == 0 && r.headerBytes+len(data) > maxHeaderBytes) {
+		return 0, false, headers.ErrHeaderTooLarge
+	}
+	return bytesRead, done, nil
+}
@@ -0,0 +1,247 @@
+package response
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"http/internal/headers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type chunkReader struct {
+	data            string
+	numBytesPerRead int
+	pos             int
+}
+
+func (r *chunkReader) Read(p []byte) (n int, err error) {
+	if r.pos >= len(r.data) {
+		return 0, io.EOF
+	}
+
+	endPos := min(r.pos+r.numBytesPerRead, len(r.data))
+	n = copy(p, r.data[r.pos:endPos])
+	r.pos += n
+	return n, nil
+}
+
+func get(h *headers.Headers, key string) string {
+	val, _ := h.Get(key)
+	return val
+}
+
+func TestStatusLineParse(t *testing.T) {
+	// Test: Good status line
+	reader := &chunkReader{
+		data: "HTTP/1.1 404 Not Found\r\n" +
+			"Content-Length: 0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "1.1", r.StatusLine.HttpVersion)
+	assert.Equal(t, StatusCode404, r.StatusLine.StatusCode)
+	assert.Equal(t, "Not Found", r.StatusLine.ReasonPhrase)
+	assert.False(t, r.Close)
+
+	// Test: Missing reason phrase
+	reader = &chunkReader{
+		data:            "HTTP/1.1 418 \r\nContent-Length: 0\r\n\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCode(418), r.StatusLine.StatusCode)
+	assert.Equal(t, "", r.StatusLine.ReasonPhrase)
+
+	// Test: Interim responses are skipped
+	reader = &chunkReader{
+		data: "HTTP/1.1 100 Continue\r\n\r\n" +
+			"HTTP/1.1 103 Early Hints\r\nLink: </style.css>\r\n\r\n" +
+			"HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok",
+		numBytesPerRead: 5,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCode200, r.StatusLine.StatusCode)
+	assert.Equal(t, "", get(r.Headers, "link"))
+	assert.Equal(t, "ok", string(r.Body))
+
+	tests := []struct {
+		data string
+		err  error
+	}{
+		{"HTTP/1.1 2OO OK\r\n\r\n", ErrInvalidStatusLine},
+		{"HTTP/1.1 20 OK\r\n\r\n", ErrInvalidStatusLine},
+		{"HTTP/1.1\r\n\r\n", ErrInvalidStatusLine},
+		{"HTP/1.1 200 OK\r\n\r\n", ErrInvalidStatusLine},
+		{"HTTP/2 200 OK\r\n\r\n", ErrUnsupportedVersion},
+		{"HTTP/1.1 200 " + strings.Repeat("a", maxStatusLineBytes) + "\r\n\r\n", ErrStatusLineTooLong},
+		{"HTTP/1.1 200 OK\r\nBad Header: x\r\n\r\n", headers.ErrInvalidHeader},
+	}
+	for _, tc := range tests {
+		_, err := ResponseFromReader(&chunkReader{data: tc.data, numBytesPerRead: 4})
+		assert.ErrorIs(t, err, tc.err, tc.data)
+	}
+
+	// Test: Connection closed before anything was sent
+	_, err = ResponseFromReader(&chunkReader{numBytesPerRead: 4})
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: Connection closed in the middle of the headers
+	_, err = ResponseFromReader(&chunkReader{data: "HTTP/1.1 200 OK\r\nHost", numBytesPerRead: 4})
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestResponseBody(t *testing.T) {
+	// Test: Content-length body
+	reader := &chunkReader{
+		data: "HTTP/1.1 200 OK\r\n" +
+			"Content-Type: text/plain\r\n" +
+			"Content-Length: 13\r\n" +
+			"\r\n" +
+			"hello world!\n",
+		numBytesPerRead: 3,
+	}
+	r, err := ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", get(r.Headers, "content-type"))
+	assert.Equal(t, int64(13), r.ContentLength)
+	assert.Equal(t, "hello world!\n", string(r.Body))
+
+	// Test: Body shorter than reported content length
+	reader = &chunkReader{
+		data: "HTTP/1.1 200 OK\r\n" +
+			"Content-Length: 20\r\n" +
+			"\r\n" +
+			"partial content",
+		numBytesPerRead: 3,
+	}
+	_, err = ResponseFromReader(reader)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Test: Body runs until the connection is closed
+	reader = &chunkReader{
+		data: "HTTP/1.1 200 OK\r\n" +
+			"\r\n" +
+			"all of this is body",
+		numBytesPerRead: 4,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), r.ContentLength)
+	assert.True(t, r.Close)
+	assert.Equal(t, "all of this is body", string(r.Body))
+
+	// Test: No body for 204 and 304 even without framing
+	for _, code := range []string{"204 No Content", "304 Not Modified"} {
+		reader = &chunkReader{
+			data:            "HTTP/1.1 " + code + "\r\n\r\n",
+			numBytesPerRead: 4,
+		}
+		r, err = ResponseFromReader(reader)
+		require.NoError(t, err)
+		assert.Empty(t, r.Body)
+		assert.False(t, r.Close)
+	}
+
+	// Test: HTTP/1.0 closes unless asked to keep the connection
+	reader = &chunkReader{
+		data:            "HTTP/1.0 200 OK\r\nContent-Length: 0\r\n\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.True(t, r.Close)
+
+	tests := []struct {
+		data string
+		err  error
+	}{
+		{"HTTP/1.1 200 OK\r\nContent-Length: -1\r\n\r\n", ErrInvalidContentLength},
+		{"HTTP/1.1 200 OK\r\nContent-Length: 1\r\nContent-Length: 1\r\n\r\nx", ErrInvalidContentLength},
+		{"HTTP/1.1 200 OK\r\nContent-Length: 1\r\nTransfer-Encoding: chunked\r\n\r\n", ErrInvalidFraming},
+		{"HTTP/1.1 200 OK\r\nTransfer-Encoding: gzip\r\n\r\n", ErrUnsupportedEncoding},
+	}
+	for _, tc := range tests {
+		_, err := ResponseFromReader(&chunkReader{data: tc.data, numBytesPerRead: 4})
+		assert.ErrorIs(t, err, tc.err, tc.data)
+	}
+}
+
+func TestChunkedResponseBody(t *testing.T) {
+	// Test: Chunked body with extensions and trailers
+	reader := &chunkReader{
+		data: "HTTP/1.1 200 OK\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: X-Checksum\r\n" +
+			"\r\n" +
+			"6;name=value\r\nhello \r\n" +
+			"5\r\nworld\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), r.ContentLength)
+	assert.Equal(t, "hello world", string(r.Body))
+	assert.Equal(t, "abc", get(r.Trailers, "x-checksum"))
+
+	tests := []struct {
+		data string
+		err  error
+	}{
+		{"zz\r\n", ErrInvalidChunk},
+		{"5\r\nhello\r\n-1\r\n", ErrInvalidChunk},
+		{"5\r\nhelloX\r\n", ErrInvalidChunk},
+		{strings.Repeat("0", 4<<10+1), ErrInvalidChunk},
+		{"5\r\nhel", io.ErrUnexpectedEOF},
+		{"0\r\nX-Checksum: abc\r\n", io.ErrUnexpectedEOF},
+	}
+	for _, tc := range tests {
+		reader := &chunkReader{
+			data:            "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n" + tc.data,
+			numBytesPerRead: 2,
+		}
+		_, err := ResponseFromReader(reader)
+		assert.ErrorIs(t, err, tc.err, tc.data)
+	}
+}
+
+func TestReaderMultipleResponses(t *testing.T) {
+	reader := &chunkReader{
+		data: "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nfirst" +
+			"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n6\r\nsecond\r\n0\r\n\r\n" +
+			"HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nthird" +
+			"HTTP/1.1 200 OK\r\nContent-Length: 6\r\n\r\nfourth",
+		numBytesPerRead: 7,
+	}
+	rr := NewReader(reader)
+
+	r, err := rr.ReadResponse("GET")
+	require.NoError(t, err)
+	body, err := io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(body))
+
+	// Unread bodies are skipped
+	_, err = rr.ReadResponse("GET")
+	require.NoError(t, err)
+
+	// The response to a HEAD has no body despite its content-length
+	r, err = rr.ReadResponse("HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), r.ContentLength)
+	body, err = io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Empty(t, body)
+
+	_, err = rr.ReadResponse("GET")
+	assert.ErrorIs(t, err, ErrInvalidStatusLine)
+}
@@ -1,30 +1,107 @@
 package response
 
 import (
-	"bytes"
 	"fmt"
 	"http/internal/headers"
 	"io"
 	"strconv"
+	"strings"
 )
 
 type StatusCode int
 type writerState int
 
 type Writer struct {
-	W     io.Writer
-	state writerState
+	W             io.Writer
+	state         writerState
+	statusCode    StatusCode
+	keepAlive     bool
+	header        *headers.Headers
+	beforeHeaders []func()
+	chunked       bool
+	trailers      []string
+	suppressBody  bool
+
+	// contentLength is the declared length of a body that isn't chunked, or
+	// -1 if there is none to hold it to. bodyWritten counts what was sent.
+	contentLength int64
+	bodyWritten   int64
+
+	// Status and body held back by WriteHeader and Write until the body is
+	// known to fit in a content-length response or outgrows the buffer.
+	pendingStatus StatusCode
+	pendingBody   []byte
+
+	// Request method and headers set by HandleConditional.
+	conditionalMethod  string
+	conditionalHeaders *headers.Headers
+
+	// Set by HandleCompression. encoder compresses the body once the headers
+	// say it is encoded.
+	compress       bool
+	acceptEncoding string
+	encoding       *encoding
+	encoder        encoder
 }
 
 func NewWriter(w io.Writer) *Writer {
-	return &Writer{W: w, state: stateInitial}
+	return &Writer{W: w, state: stateInitial, header: headers.NewHeaders(), contentLength: -1}
 }
 
-const (
-	StatusCode200 StatusCode = 200
-	StatusCode400 StatusCode = 400
-	StatusCode500 StatusCode = 500
+// Header returns headers sent along with those passed to WriteHeaders, which
+// take precedence. Middleware uses it to add headers to any response.
+func (w *Writer) Header() *headers.Headers {
+	return w.header
+}
+
+// BeforeHeaders registers fn to run just before the headers are written, while
+// Header can still be changed.
+func (w *Writer) BeforeHeaders(fn func()) {
+	w.beforeHeaders = append(w.beforeHeaders, fn)
+}
+
+// StatusCode returns the status of the response, or 0 if none has been set.
+func (w *Writer) StatusCode() StatusCode {
+	if w.statusCode == 0 {
+		return w.pendingStatus
+	}
+	return w.statusCode
+}
+
+// SuppressBody makes the writer send the status line and headers as usual but
+// drop the body, as a response to HEAD needs. Handlers can respond the way
+// they would to GET and still get a matching content-length.
+func (w *Writer) SuppressBody() {
+	w.suppressBody = true
+}
+
+// SetKeepAlive controls the connection header written by WriteHeaders when
+// the handler does not set one itself.
+func (w *Writer) SetKeepAlive(keepAlive bool) {
+	w.keepAlive = keepAlive
+}
+
+// KeepAlive reports whether the connection can be reused once the response
+// has been written. A chunked body that was never terminated can't be.
+func (w *Writer) KeepAlive() bool {
+	if w.chunked && w.state != stateBodyWritten {
+		return false
+	}
+	// The client would read the start of the next response as the rest of
+	// this body
+	if w.contentLength >= 0 && w.bodyWritten != w.contentLength {
+		return false
+	}
+	return w.keepAlive
+}
+
+// Written reports whether the response has been started, even if it is
+// still buffered.
+func (w *Writer) Written() bool {
+	return w.state != stateInitial || w.pendingStatus != 0
+}
 
+const (
 	stateInitial writerState = iota
 	stateStatusWritten
 	stateHeadersWritten
@@ -35,96 +112,118 @@ func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
 	if w.state != stateInitial {
 		return fmt.Errorf("writer not in proper state")
 	}
-	w.state = stateStatusWritten
-	switch statusCode {
-	case StatusCode200:
-		_, err := w.W.Write([]byte("HTTP/1.1 200 OK\r\n"))
-		return err
-	case StatusCode400:
-		_, err := w.W.Write([]byte("HTTP/1.1 400 Bad Request\r\n"))
-		return err
-	case StatusCode500:
-		_, err := w.W.Write([]byte("HTTP/1.1 500 Internal Server Error\r\n"))
-		return err
-	default:
-		msg := fmt.Sprintf("HTTP/1.1 %d\r\n", statusCode)
-		_, err := w.W.Write([]byte(msg))
-		return err
+	if !statusCode.Valid() {
+		return fmt.Errorf("invalid status code: %d", statusCode)
 	}
+	w.state = stateStatusWritten
+	w.statusCode = statusCode
+	_, err := w.W.Write([]byte(fmt.Sprintf("HTTP/1.1 %d %s\r\n", statusCode, StatusText(statusCode))))
+	return err
 }
 
-func GetDefaultHeaders(contentLen int) headers.Headers {
-	h := headers.Headers{}
-	h["content-length"] = fmt.Sprintf("%d", contentLen)
-	h["connection"] = "close"
-	h["content-type"] = "text/plain"
+func GetDefaultHeaders(contentLen int) *headers.Headers {
+	h := headers.NewHeaders()
+	h.Set("content-length", fmt.Sprintf("%d", contentLen))
+	h.Set("content-type", "text/plain")
 	return h
 }
 
-func (w *Writer) WriteHeaders(h headers.Headers) error {
+func (w *Writer) WriteHeaders(h *headers.Headers) error {
 	if w.state != stateStatusWritten {
 		return fmt.Errorf("writer not in proper state")
 	}
-	for k, v := range h {
-		_, err := w.W.Write([]byte(fmt.Sprintf("%s: %s\r\n", k, v)))
+	for _, fn := range w.beforeHeaders {
+		fn()
+	}
+	all := h.Clone()
+	for _, f := range w.header.Fields() {
+		if !h.Has(f.Name) {
+			all.Add(f.Name, f.Value)
+		}
+	}
+	if w.compress {
+		w.startEncoding(all)
+	}
+	if !w.hasFraming(all) {
+		// Body is delimited by closing the connection
+		w.keepAlive = false
+	}
+	if _, ok := all.Get("connection"); ok {
+		if all.HasToken("connection", "close") {
+			w.keepAlive = false
+		}
+	} else if w.keepAlive {
+		all.Set("connection", "keep-alive")
+	} else {
+		all.Set("connection", "close")
+	}
+	w.chunked = all.HasToken("transfer-encoding", "chunked")
+	w.contentLength = -1
+	if val, ok := all.Get("content-length"); ok && !w.chunked && !w.suppressBody && !isBodyless(w.statusCode) {
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil && n >= 0 {
+			w.contentLength = n
+		}
+	}
+	if trailer, ok := all.Get("trailer"); ok {
+		for _, name := range strings.Split(trailer, ",") {
+			w.trailers = append(w.trailers, strings.ToLower(strings.TrimSpace(name)))
+		}
+	}
+	if err := w.writeFields(all); err != nil {
+		return err
+	}
+	w.state = stateHeadersWritten
+	return nil
+}
+
+func (w *Writer) writeFields(h *headers.Headers) error {
+	for _, f := range h.Fields() {
+		_, err := w.W.Write([]byte(fmt.Sprintf("%s: %s\r\n", f.Name, f.Value)))
 		if err != nil {
 			return err
 		}
 	}
 	_, err := w.W.Write([]byte("\r\n"))
-	w.state = stateHeadersWritten
 	return err
 }
 
-func (w *Writer) WriteBody(p []byte) (int, error) {
-	if w.state != stateHeadersWritten {
-		return 0, fmt.Errorf("writer not in proper state")
+func (w *Writer) hasFraming(h *headers.Headers) bool {
+	if w.suppressBody || w.statusCode/100 == 1 || w.statusCode == 204 || w.statusCode == 304 {
+		return true
 	}
-	n, err := w.W.Write(p)
-	w.state = stateBodyWritten
-	return n, err
+	if _, ok := h.Get("content-length"); ok {
+		return true
+	}
+	return h.HasToken("transfer-encoding", "chunked")
 }
 
-func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
+func (w *Writer) WriteBody(p []byte) (int, error) {
 	if w.state != stateHeadersWritten {
 		return 0, fmt.Errorf("writer not in proper state")
 	}
-
-	endIdx := bytes.Index(p, []byte(headers.SEPARATOR))
-	if endIdx == -1 {
-		return 0, fmt.Errorf("invalid chunk")
+	if w.encoder != nil {
+		// Finish ends the chunked body the encoder writes to
+		return w.encoder.Write(p)
 	}
-	hexStr := string(p[:endIdx])
-	lineSize, err := strconv.ParseInt(hexStr, 16, 64)
-	if err != nil {
-		fmt.Println("Error converting hexadecimal to integer:", err)
-		return 0, err
-	}
-
-	idx := endIdx + len(headers.SEPARATOR)
-	n, err := w.W.Write(p[idx : idx+int(lineSize)])
-	if err != nil {
-		return 0, err
-	}
-	if n != int(lineSize) {
-		return 0, fmt.Errorf("short write")
-	}
-
-	return n, nil
+	return w.writeFramed(p)
 }
 
-func (w *Writer) WriteChunkedBodyDone() (int, error) {
+// writeFramed writes body bytes that aren't chunked, holding them to the
+// declared content-length so extra bytes can't be read as the next response.
+func (w *Writer) writeFramed(p []byte) (int, error) {
 	w.state = stateBodyWritten
-	return 0, nil
-}
-
-func (w *Writer) WriteTrailers(h headers.Headers) error {
-	for k, v := range h {
-		_, err := w.W.Write([]byte(fmt.Sprintf("%s: %s\r\n", k, v)))
-		if err != nil {
-			return err
-		}
+	if w.suppressBody {
+		return len(p), nil
 	}
-	_, err := w.W.Write([]byte("\r\n"))
-	return err
+	var overflow bool
+	if w.contentLength >= 0 && w.bodyWritten+int64(len(p)) > w.contentLength {
+		p = p[:w.contentLength-w.bodyWritten]
+		overflow = true
+	}
+	n, err := w.W.Write(p)
+	w.bodyWritten += int64(n)
+	if err == nil && overflow {
+		err = fmt.Errorf("body longer than content-length %d", w.contentLength)
+	}
+	return n, err
 }
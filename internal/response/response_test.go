@@ -0,0 +1,362 @@
+package response
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"http/internal/headers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteHeaders(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Header().Set("x-request-id", "abc")
+	w.Header().Set("content-type", "text/html")
+
+	h := headers.NewHeaders()
+	h.Set("Content-Type", "text/plain")
+	h.Add("Set-Cookie", "a=1")
+	h.Add("Set-Cookie", "b=2")
+	h.Set("Content-Length", "0")
+
+	require.NoError(t, w.WriteStatusLine(StatusCode200))
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Set-Cookie: a=1\r\n"+
+		"Set-Cookie: b=2\r\n"+
+		"Content-Length: 0\r\n"+
+		"x-request-id: abc\r\n"+
+		"connection: close\r\n"+
+		"\r\n", buf.String())
+}
+
+func TestWriteStatusLine(t *testing.T) {
+	tests := []struct {
+		code StatusCode
+		line string
+	}{
+		{StatusCode200, "HTTP/1.1 200 OK\r\n"},
+		{StatusCode404, "HTTP/1.1 404 Not Found\r\n"},
+		{StatusCode(418), "HTTP/1.1 418 \r\n"},
+		{StatusCode511, "HTTP/1.1 511 Network Authentication Required\r\n"},
+		{StatusCode(999), "HTTP/1.1 999 \r\n"},
+	}
+	for _, tc := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		require.NoError(t, w.WriteStatusLine(tc.code))
+		assert.Equal(t, tc.line, buf.String())
+	}
+
+	for _, code := range []StatusCode{0, 99, 1000, -200} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		assert.Error(t, w.WriteStatusLine(code))
+		assert.Empty(t, buf.String())
+		assert.False(t, w.Written())
+	}
+}
+
+func TestStatusText(t *testing.T) {
+	assert.Equal(t, "Content Too Large", StatusText(StatusCode413))
+	assert.Equal(t, "Early Hints", StatusText(StatusCode103))
+	assert.Equal(t, "", StatusText(StatusCode(299)))
+	assert.Equal(t, "206 Partial Content", StatusCode206.String())
+}
+
+func chunkedWriter(t *testing.T, buf *bytes.Buffer, trailer string) *Writer {
+	w := NewWriter(buf)
+	h := headers.NewHeaders()
+	h.Set("transfer-encoding", "chunked")
+	if trailer != "" {
+		h.Set("trailer", trailer)
+	}
+	require.NoError(t, w.WriteStatusLine(StatusCode200))
+	require.NoError(t, w.WriteHeaders(h))
+	buf.Reset()
+	return w
+}
+
+func TestChunkedBody(t *testing.T) {
+	// Test: Chunks are framed and terminated
+	var buf bytes.Buffer
+	w := chunkedWriter(t, &buf, "")
+	w.SetKeepAlive(true)
+	n, err := w.WriteChunkedBody([]byte("hello "))
+	require.NoError(t, err)
+	assert.Equal(t, 6, n)
+	_, err = w.WriteChunkedBody([]byte("chunked world"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody(nil)
+	require.NoError(t, err)
+	assert.False(t, w.KeepAlive())
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	assert.True(t, w.KeepAlive())
+	assert.Equal(t, "6\r\nhello \r\nd\r\nchunked world\r\n0\r\n\r\n", buf.String())
+
+	// Test: Stream with announced trailers
+	buf.Reset()
+	w = chunkedWriter(t, &buf, "X-Checksum")
+	body := w.ChunkedBody()
+	_, err = body.Write([]byte("abc"))
+	require.NoError(t, err)
+	trailers := headers.NewHeaders()
+	trailers.Set("x-checksum", "123")
+	require.NoError(t, body.CloseWithTrailers(trailers))
+	assert.Equal(t, "3\r\nabc\r\n0\r\nx-checksum: 123\r\n\r\n", buf.String())
+
+	// Test: Trailers must be announced
+	buf.Reset()
+	w = chunkedWriter(t, &buf, "x-checksum")
+	trailers = headers.NewHeaders()
+	trailers.Set("x-other", "1")
+	assert.Error(t, w.WriteTrailers(trailers))
+
+	// Test: Framing fields can't be trailers
+	trailers = headers.NewHeaders()
+	trailers.Set("content-length", "3")
+	assert.Error(t, w.WriteTrailers(trailers))
+
+	// Test: Chunked writes need chunked headers
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(StatusCode200))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(3)))
+	_, err = w.WriteChunkedBody([]byte("abc"))
+	assert.Error(t, err)
+}
+
+func TestWrite(t *testing.T) {
+	// Implicit 200 with a content-length worked out when the response ends
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetKeepAlive(true)
+	w.Header().Set("content-type", "text/plain")
+	_, err := w.Write([]byte("hello "))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("world"))
+	require.NoError(t, err)
+	assert.Empty(t, buf.String())
+	assert.Equal(t, StatusCode200, w.StatusCode())
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"content-type: text/plain\r\n"+
+		"content-length: 11\r\n"+
+		"connection: keep-alive\r\n"+
+		"\r\n"+
+		"hello world", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Explicit status with no body
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.WriteHeader(StatusCode404))
+	assert.Error(t, w.WriteHeader(StatusCode200))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\n"+
+		"content-length: 0\r\n"+
+		"connection: close\r\n"+
+		"\r\n", buf.String())
+
+	// Nothing written at all is an empty 200
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"content-length: 0\r\n"+
+		"connection: close\r\n"+
+		"\r\n", buf.String())
+
+	// A chunked response set up by the handler never gets a content-length
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.Header().Set("transfer-encoding", "chunked")
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"transfer-encoding: chunked\r\n"+
+		"connection: close\r\n"+
+		"\r\n"+
+		"0\r\n\r\n", buf.String())
+
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetKeepAlive(true)
+	w.HandleConditional("GET", headers.NewHeaders())
+	w.Header().Set("transfer-encoding", "chunked")
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	resp, err := ResponseFromReader(&buf)
+	require.NoError(t, err)
+	assert.False(t, resp.Headers.Has("content-length"))
+	assert.Equal(t, "hello", string(resp.Body))
+	assert.True(t, w.KeepAlive())
+
+	// 204 gets no content-length
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.WriteHeader(StatusCode204))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\nconnection: close\r\n\r\n", buf.String())
+
+	// A content-length set by the handler is used as is and the body isn't held back
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.Header().Set("content-length", "5")
+	_, err = w.Write([]byte("ab"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("cde"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"content-length: 5\r\n"+
+		"connection: close\r\n"+
+		"\r\n"+
+		"abcde", buf.String())
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"content-length: 5\r\n"+
+		"connection: close\r\n"+
+		"\r\n"+
+		"abcde", buf.String())
+
+	// A body that doesn't match its content-length can't be followed by
+	// another response on the connection
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetKeepAlive(true)
+	w.Header().Set("content-length", "10")
+	w.Write([]byte("abc"))
+	require.NoError(t, w.Finish())
+	assert.False(t, w.KeepAlive())
+
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetKeepAlive(true)
+	w.Header().Set("content-length", "3")
+	n, err := w.Write([]byte("abcdef"))
+	assert.Error(t, err)
+	assert.Equal(t, 3, n)
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nabc"))
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetKeepAlive(true)
+	require.NoError(t, w.WriteStatusLine(StatusCode200))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err = w.WriteBody([]byte("hello!"))
+	assert.Error(t, err)
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nhello"))
+
+	// Reset discards a buffered response but not one already sent
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.Write([]byte("partial"))
+	assert.True(t, w.Written())
+	assert.True(t, w.Reset())
+	assert.False(t, w.Written())
+	assert.Empty(t, buf.String())
+	w.Header().Set("content-length", "1")
+	w.Write([]byte("x"))
+	assert.False(t, w.Reset())
+}
+
+func TestWriteLargeBodyChunked(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetKeepAlive(true)
+	first := bytes.Repeat([]byte("a"), bufferBeforeChunking)
+	_, err := w.Write(first)
+	require.NoError(t, err)
+	assert.Empty(t, buf.String())
+	_, err = w.Write([]byte("bc"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("def"))
+	require.NoError(t, err)
+	assert.False(t, w.KeepAlive())
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"transfer-encoding: chunked\r\n"+
+		"connection: keep-alive\r\n"+
+		"\r\n"+
+		"1002\r\n"+string(first)+"bc\r\n"+
+		"3\r\ndef\r\n"+
+		"0\r\n\r\n", buf.String())
+}
+
+// countingWriter counts the writes that would each be a syscall on a net.Conn.
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.writes++
+	return cw.Buffer.Write(p)
+}
+
+func TestFlush(t *testing.T) {
+	var out countingWriter
+	w := NewBufferedWriter(&out)
+	require.NoError(t, w.WriteStatusLine(StatusCode200))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Zero(t, out.writes)
+	require.NoError(t, w.Flush())
+	assert.Equal(t, 1, out.writes)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"content-length: 5\r\n"+
+		"content-type: text/plain\r\n"+
+		"connection: close\r\n"+
+		"\r\n"+
+		"hello", out.String())
+
+	// Flushing a response whose length isn't known yet makes it chunked
+	out = countingWriter{}
+	w = NewBufferedWriter(&out)
+	w.Write([]byte("event: 1\n"))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"transfer-encoding: chunked\r\n"+
+		"connection: close\r\n"+
+		"\r\n"+
+		"9\r\nevent: 1\n\r\n", out.String())
+	w.Write([]byte("event: 2\n"))
+	require.NoError(t, w.Finish())
+	require.NoError(t, w.Flush())
+	assert.True(t, strings.HasSuffix(out.String(), "9\r\nevent: 2\n\r\n0\r\n\r\n"))
+	assert.Equal(t, 2, out.writes)
+}
+
+func benchmarkResponse(b *testing.B, newWriter func(io.Writer) *Writer) {
+	body := []byte("hello world")
+	var out countingWriter
+	for i := 0; i < b.N; i++ {
+		out.Reset()
+		w := newWriter(&out)
+		w.Header().Set("content-type", "text/plain")
+		w.Header().Set("x-request-id", "abc")
+		w.Write(body)
+		w.Finish()
+		w.Flush()
+	}
+	b.ReportMetric(float64(out.writes)/float64(b.N), "writes/op")
+}
+
+func BenchmarkResponseUnbuffered(b *testing.B) {
+	benchmarkResponse(b, NewWriter)
+}
+
+func BenchmarkResponseBuffered(b *testing.B) {
+	benchmarkResponse(b, NewBufferedWriter)
+}
@@ -0,0 +1,155 @@
+package response
+
+import "fmt"
+
+// Status codes registered with IANA, see
+// https://www.iana.org/assignments/http-status-codes
+const (
+	StatusCode100 StatusCode = 100
+	StatusCode101 StatusCode = 101
+	StatusCode102 StatusCode = 102
+	StatusCode103 StatusCode = 103
+
+	StatusCode200 StatusCode = 200
+	StatusCode201 StatusCode = 201
+	StatusCode202 StatusCode = 202
+	StatusCode203 StatusCode = 203
+	StatusCode204 StatusCode = 204
+	StatusCode205 StatusCode = 205
+	StatusCode206 StatusCode = 206
+	StatusCode207 StatusCode = 207
+	StatusCode208 StatusCode = 208
+	StatusCode226 StatusCode = 226
+
+	StatusCode300 StatusCode = 300
+	StatusCode301 StatusCode = 301
+	StatusCode302 StatusCode = 302
+	StatusCode303 StatusCode = 303
+	StatusCode304 StatusCode = 304
+	StatusCode305 StatusCode = 305
+	StatusCode307 StatusCode = 307
+	StatusCode308 StatusCode = 308
+
+	StatusCode400 StatusCode = 400
+	StatusCode401 StatusCode = 401
+	StatusCode402 StatusCode = 402
+	StatusCode403 StatusCode = 403
+	StatusCode404 StatusCode = 404
+	StatusCode405 StatusCode = 405
+	StatusCode406 StatusCode = 406
+	StatusCode407 StatusCode = 407
+	StatusCode408 StatusCode = 408
+	StatusCode409 StatusCode = 409
+	StatusCode410 StatusCode = 410
+	StatusCode411 StatusCode = 411
+	StatusCode412 StatusCode = 412
+	StatusCode413 StatusCode = 413
+	StatusCode414 StatusCode = 414
+	StatusCode415 StatusCode = 415
+	StatusCode416 StatusCode = 416
+	StatusCode417 StatusCode = 417
+	StatusCode421 StatusCode = 421
+	StatusCode422 StatusCode = 422
+	StatusCode423 StatusCode = 423
+	StatusCode424 StatusCode = 424
+	StatusCode425 StatusCode = 425
+	StatusCode426 StatusCode = 426
+	StatusCode428 StatusCode = 428
+	StatusCode429 StatusCode = 429
+	StatusCode431 StatusCode = 431
+	StatusCode451 StatusCode = 451
+
+	StatusCode500 StatusCode = 500
+	StatusCode501 StatusCode = 501
+	StatusCode502 StatusCode = 502
+	StatusCode503 StatusCode = 503
+	StatusCode504 StatusCode = 504
+	StatusCode505 StatusCode = 505
+	StatusCode506 StatusCode = 506
+	StatusCode507 StatusCode = 507
+	StatusCode508 StatusCode = 508
+	StatusCode510 StatusCode = 510
+	StatusCode511 StatusCode = 511
+)
+
+var statusText = map[StatusCode]string{
+	StatusCode100: "Continue",
+	StatusCode101: "Switching Protocols",
+	StatusCode102: "Processing",
+	StatusCode103: "Early Hints",
+	StatusCode200: "OK",
+	StatusCode201: "Created",
+	StatusCode202: "Accepted",
+	StatusCode203: "Non-Authoritative Information",
+	StatusCode204: "No Content",
+	StatusCode205: "Reset Content",
+	StatusCode206: "Partial Content",
+	StatusCode207: "Multi-Status",
+	StatusCode208: "Already Reported",
+	StatusCode226: "IM Used",
+	StatusCode300: "Multiple Choices",
+	StatusCode301: "Moved Permanently",
+	StatusCode302: "Found",
+	StatusCode303: "See Other",
+	StatusCode304: "Not Modified",
+	StatusCode305: "Use Proxy",
+	StatusCode307: "Temporary Redirect",
+	StatusCode308: "Permanent Redirect",
+	StatusCode400: "Bad Request",
+	StatusCode401: "Unauthorized",
+	StatusCode402: "Payment Required",
+	StatusCode403: "Forbidden",
+	StatusCode404: "Not Found",
+	StatusCode405: "Method Not Allowed",
+	StatusCode406: "Not Acceptable",
+	StatusCode407: "Proxy Authentication Required",
+	StatusCode408: "Request Timeout",
+	StatusCode409: "Conflict",
+	StatusCode410: "Gone",
+	StatusCode411: "Length Required",
+	StatusCode412: "Precondition Failed",
+	StatusCode413: "Content Too Large",
+	StatusCode414: "URI Too Long",
+	StatusCode415: "Unsupported Media Type",
+	StatusCode416: "Range Not Satisfiable",
+	StatusCode417: "Expectation Failed",
+	StatusCode421: "Misdirected Request",
+	StatusCode422: "Unprocessable Content",
+	StatusCode423: "Locked",
+	StatusCode424: "Failed Dependency",
+	StatusCode425: "Too Early",
+	StatusCode426: "Upgrade Required",
+	StatusCode428: "Precondition Required",
+	StatusCode429: "Too Many Requests",
+	StatusCode431: "Request Header Fields Too Large",
+	StatusCode451: "Unavailable For Legal Reasons",
+	StatusCode500: "Internal Server Error",
+	StatusCode501: "Not Implemented",
+	StatusCode502: "Bad Gateway",
+	StatusCode503: "Service Unavailable",
+	StatusCode504: "Gateway Timeout",
+	StatusCode505: "HTTP Version Not Supported",
+	StatusCode506: "Variant Also Negotiates",
+	StatusCode507: "Insufficient Storage",
+	StatusCode508: "Loop Detected",
+	StatusCode510: "Not Extended",
+	StatusCode511: "Network Authentication Required",
+}
+
+// StatusText returns the reason phrase for code, or "" if it is unregistered.
+func StatusText(code StatusCode) string {
+	return statusText[code]
+}
+
+// Valid reports whether code is a three digit status code. Unregistered codes
+// are allowed and are sent without a reason phrase.
+func (code StatusCode) Valid() bool {
+	return code >= 100 && code <= 999
+}
+
+func (code StatusCode) String() string {
+	if text := StatusText(code); text != "" {
+		return fmt.Sprintf("%d %s", code, text)
+	}
+	return fmt.Sprintf("%d", code)
+}
@@ -0,0 +1,133 @@
+package response
+
+import (
+	"fmt"
+	"http/internal/headers"
+	"strconv"
+)
+
+// bufferBeforeChunking is how much of the body Write holds back while waiting
+// to see if the whole body is known, in which case a content-length is sent
+// instead of switching to chunked encoding.
+const bufferBeforeChunking = 4 << 10
+
+// WriteHeader sets the status of the response. Headers set through Header
+// are sent along with it once the first part of the body is ready.
+func (w *Writer) WriteHeader(statusCode StatusCode) error {
+	if w.Written() {
+		return fmt.Errorf("writer not in proper state")
+	}
+	if !statusCode.Valid() {
+		return fmt.Errorf("invalid status code: %d", statusCode)
+	}
+	w.pendingStatus = statusCode
+	return nil
+}
+
+// Write adds p to the body, sending a 200 status first if WriteHeader hasn't
+// been called. It can be called any number of times. Unless a content-length
+// has been set, the body is buffered until it outgrows a small buffer and then
+// sent chunked; shorter bodies get a content-length when the response ends.
+func (w *Writer) Write(p []byte) (int, error) {
+	switch w.state {
+	case stateInitial:
+		if w.pendingStatus == 0 {
+			w.pendingStatus = StatusCode200
+		}
+		// A conditional 200 needs the whole body before its etag is known
+		holdAll := w.conditionalHeaders != nil && w.pendingStatus == StatusCode200 && !w.header.Has("etag")
+		if !holdAll && (w.header.Has("content-length") || w.header.HasToken("transfer-encoding", "chunked")) {
+			if err := w.commit(); err != nil {
+				return 0, err
+			}
+			return w.writeCommitted(p)
+		}
+		w.pendingBody = append(w.pendingBody, p...)
+		if holdAll || len(w.pendingBody) <= bufferBeforeChunking {
+			return len(p), nil
+		}
+		w.header.Set("transfer-encoding", "chunked")
+		if err := w.commit(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	case stateStatusWritten:
+		// The status line was written directly, send the headers without a
+		// content-length so the connection delimits the body.
+		if err := w.WriteHeaders(headers.NewHeaders()); err != nil {
+			return 0, err
+		}
+		return w.writeCommitted(p)
+	case stateHeadersWritten:
+		return w.writeCommitted(p)
+	default:
+		if w.chunked {
+			return 0, fmt.Errorf("writer not in proper state")
+		}
+		return w.writeCommitted(p)
+	}
+}
+
+// Finish ends a response started with WriteHeader or Write, sending anything
+// still buffered and terminating a chunked body. A handler that wrote nothing
+// gets an empty 200. The server calls it once the handler returns.
+func (w *Writer) Finish() error {
+	if w.state == stateInitial {
+		if w.pendingStatus == 0 {
+			w.pendingStatus = StatusCode200
+		}
+		w.applyConditional()
+		if !w.header.Has("content-length") && !w.header.HasToken("transfer-encoding", "chunked") && !isBodyless(w.pendingStatus) {
+			w.header.Set("content-length", strconv.Itoa(len(w.pendingBody)))
+		}
+		if err := w.commit(); err != nil {
+			return err
+		}
+	}
+	if w.chunked && w.state == stateHeadersWritten {
+		_, err := w.WriteChunkedBodyDone()
+		return err
+	}
+	return nil
+}
+
+// Reset drops a response that has been started but not yet sent, so that an
+// error response can be written in its place. Headers describing the dropped
+// body go with it. It reports false if part of the response has already been
+// sent.
+func (w *Writer) Reset() bool {
+	if w.state != stateInitial {
+		return false
+	}
+	for _, name := range []string{"content-type", "content-length", "content-encoding", "content-range", "transfer-encoding", "trailer", "etag", "last-modified"} {
+		w.header.Del(name)
+	}
+	w.pendingStatus = 0
+	w.pendingBody = nil
+	return true
+}
+
+// commit writes the pending status line, headers and any buffered body.
+func (w *Writer) commit() error {
+	if err := w.WriteStatusLine(w.pendingStatus); err != nil {
+		return err
+	}
+	if err := w.WriteHeaders(headers.NewHeaders()); err != nil {
+		return err
+	}
+	body := w.pendingBody
+	w.pendingBody = nil
+	_, err := w.writeCommitted(body)
+	return err
+}
+
+func (w *Writer) writeCommitted(p []byte) (int, error) {
+	if w.chunked {
+		return w.WriteChunkedBody(p)
+	}
+	return w.writeFramed(p)
+}
+
+func isBodyless(statusCode StatusCode) bool {
+	return statusCode/100 == 1 || statusCode == StatusCode204 || statusCode == StatusCode304
+}
@@ -0,0 +1,282 @@
+package router
+
+import (
+	"fmt"
+	"http/internal/headers"
+	"http/internal/request"
+	"http/internal/response"
+	"http/internal/server"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+type segmentKind int
+
+const (
+	segmentStatic segmentKind = iota
+	segmentParam
+	segmentWildcard
+)
+
+type segment struct {
+	kind  segmentKind
+	value string
+}
+
+type route struct {
+	method   string
+	pattern  string
+	segments []segment
+	handler  server.Handler
+}
+
+type table struct {
+	routes   []*route
+	notFound server.Handler
+}
+
+// Router dispatches requests to handlers by method and path. Patterns are
+// made of static segments, {name} parameters and a trailing {name...} or *
+// wildcard that matches the rest of the path.
+type Router struct {
+	table      *table
+	prefix     string
+	middleware []server.Middleware
+}
+
+func New() *Router {
+	return &Router{table: &table{}}
+}
+
+// Use adds middleware applied to every route registered on r afterwards.
+func (r *Router) Use(mw ...server.Middleware) {
+	r.middleware = append(r.middleware, mw...)
+}
+
+// Group returns a router that registers routes under prefix, sharing the
+// route table and the middleware added to r so far.
+func (r *Router) Group(prefix string) *Router {
+	return &Router{
+		table:      r.table,
+		prefix:     r.prefix + strings.TrimSuffix(prefix, "/"),
+		middleware: append([]server.Middleware{}, r.middleware...),
+	}
+}
+
+func (r *Router) Handle(method, pattern string, handler server.Handler) {
+	pattern = r.prefix + pattern
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+	handler = server.Chain(r.middleware...)(handler)
+	r.table.routes = append(r.table.routes, &route{
+		method:   method,
+		pattern:  pattern,
+		segments: segments,
+		handler:  handler,
+	})
+}
+
+func (r *Router) Get(pattern string, handler server.Handler) {
+	r.Handle("GET", pattern, handler)
+}
+
+func (r *Router) Post(pattern string, handler server.Handler) {
+	r.Handle("POST", pattern, handler)
+}
+
+func (r *Router) Put(pattern string, handler server.Handler) {
+	r.Handle("PUT", pattern, handler)
+}
+
+func (r *Router) Patch(pattern string, handler server.Handler) {
+	r.Handle("PATCH", pattern, handler)
+}
+
+func (r *Router) Delete(pattern string, handler server.Handler) {
+	r.Handle("DELETE", pattern, handler)
+}
+
+// NotFound replaces the default 404 response for unmatched paths.
+func (r *Router) NotFound(handler server.Handler) {
+	r.table.notFound = handler
+}
+
+// Handler returns the server.Handler that dispatches to the registered routes.
+func (r *Router) Handler() server.Handler {
+	return r.dispatch
+}
+
+// dispatch runs the most specific route for the method and path. HEAD falls
+// back to the GET route, whose body the server drops, and OPTIONS is answered
+// with the allowed methods unless a route handles it.
+func (r *Router) dispatch(w *response.Writer, req *request.Request) {
+	method := req.RequestLine.Method
+	if req.RequestLine.Target.Form == request.AsteriskForm {
+		w.Header().Set("allow", r.allowAll())
+		w.WriteHeader(response.StatusCode204)
+		return
+	}
+	// Segments are split before decoding so an encoded / stays inside its
+	// segment
+	parts := splitPath(req.RequestLine.Target.RawPath)
+	for i, part := range parts {
+		if p, err := url.PathUnescape(part); err == nil {
+			parts[i] = p
+		}
+	}
+
+	var best, bestGet *route
+	var bestParams, bestGetParams map[string]string
+	allowed := map[string]bool{}
+	for _, rt := range r.table.routes {
+		params, ok := rt.match(parts)
+		if !ok {
+			continue
+		}
+		allowed[rt.method] = true
+		if method == "HEAD" && rt.method == "GET" && (bestGet == nil || rt.moreSpecific(bestGet)) {
+			bestGet, bestGetParams = rt, params
+		}
+		if rt.method != method {
+			continue
+		}
+		if best == nil || rt.moreSpecific(best) {
+			best, bestParams = rt, params
+		}
+	}
+	if best == nil && bestGet != nil {
+		best, bestParams = bestGet, bestGetParams
+	}
+
+	if best != nil {
+		for k, v := range bestParams {
+			req.SetPathValue(k, v)
+		}
+		best.handler(w, req)
+		return
+	}
+	if len(allowed) > 0 {
+		if method == "OPTIONS" {
+			w.Header().Set("allow", allowHeader(allowed))
+			w.WriteHeader(response.StatusCode204)
+			return
+		}
+		h := headers.NewHeaders()
+		h.Set("allow", allowHeader(allowed))
+		writeError(w, response.StatusCode405, h)
+		return
+	}
+	if r.table.notFound != nil {
+		r.table.notFound(w, req)
+		return
+	}
+	writeError(w, response.StatusCode404, headers.NewHeaders())
+}
+
+// allowAll lists every method with a route, for OPTIONS *.
+func (r *Router) allowAll() string {
+	allowed := map[string]bool{}
+	for _, rt := range r.table.routes {
+		allowed[rt.method] = true
+	}
+	return allowHeader(allowed)
+}
+
+// allowHeader lists methods for an allow header, adding HEAD where GET is
+// allowed and OPTIONS which the router always answers.
+func allowHeader(allowed map[string]bool) string {
+	if allowed["GET"] {
+		allowed["HEAD"] = true
+	}
+	allowed["OPTIONS"] = true
+	methods := make([]string, 0, len(allowed))
+	for m := range allowed {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+func writeError(w *response.Writer, statusCode response.StatusCode, h *headers.Headers) {
+	msg := response.StatusText(statusCode)
+	h.Set("content-type", "text/plain")
+	h.Set("content-length", fmt.Sprintf("%d", len(msg)))
+	w.WriteStatusLine(statusCode)
+	w.WriteHeaders(h)
+	w.WriteBody([]byte(msg))
+}
+
+func (rt *route) match(parts []string) (map[string]string, bool) {
+	params := map[string]string{}
+	for i, seg := range rt.segments {
+		if seg.kind == segmentWildcard {
+			params[seg.value] = strings.Join(parts[i:], "/")
+			return params, true
+		}
+		if i >= len(parts) {
+			return nil, false
+		}
+		switch seg.kind {
+		case segmentStatic:
+			if parts[i] != seg.value {
+				return nil, false
+			}
+		case segmentParam:
+			if parts[i] == "" {
+				return nil, false
+			}
+			params[seg.value] = parts[i]
+		}
+	}
+	if len(parts) != len(rt.segments) {
+		return nil, false
+	}
+	return params, true
+}
+
+// moreSpecific prefers static segments over parameters over wildcards,
+// comparing from the start of the path.
+func (rt *route) moreSpecific(other *route) bool {
+	for i := 0; i < len(rt.segments) && i < len(other.segments); i++ {
+		if rt.segments[i].kind != other.segments[i].kind {
+			return rt.segments[i].kind < other.segments[i].kind
+		}
+	}
+	return len(rt.segments) > len(other.segments)
+}
+
+func parsePattern(pattern string) ([]segment, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("pattern must start with /: %s", pattern)
+	}
+	parts := splitPath(pattern)
+	segments := make([]segment, 0, len(parts))
+	for i, part := range parts {
+		last := i == len(parts)-1
+		switch {
+		case part == "*" && last:
+			segments = append(segments, segment{kind: segmentWildcard, value: "*"})
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "...}") && last:
+			name := strings.TrimSuffix(strings.TrimPrefix(part, "{"), "...}")
+			segments = append(segments, segment{kind: segmentWildcard, value: name})
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}"):
+			name := strings.TrimSuffix(strings.TrimPrefix(part, "{"), "}")
+			if name == "" || strings.ContainsAny(name, "{}.") {
+				return nil, fmt.Errorf("invalid parameter in pattern: %s", pattern)
+			}
+			segments = append(segments, segment{kind: segmentParam, value: name})
+		case strings.ContainsAny(part, "{}*"):
+			return nil, fmt.Errorf("invalid segment in pattern: %s", pattern)
+		default:
+			segments = append(segments, segment{kind: segmentStatic, value: part})
+		}
+	}
+	return segments, nil
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
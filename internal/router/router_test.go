@@ -0,0 +1,147 @@
+package router
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"http/internal/request"
+	"http/internal/response"
+	"http/internal/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(t *testing.T, r *Router, raw string) string {
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	w := response.NewWriter(&buf)
+	r.Handler()(w, req)
+	require.NoError(t, w.Finish())
+	return buf.String()
+}
+
+func reply(msg string) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusCode200)
+		w.WriteHeaders(response.GetDefaultHeaders(len(msg)))
+		w.WriteBody([]byte(msg))
+	}
+}
+
+func TestRouter(t *testing.T) {
+	r := New()
+	var got *request.Request
+	r.Get("/users/{id}", func(w *response.Writer, req *request.Request) {
+		got = req
+		reply("user")(w, req)
+	})
+	r.Get("/users/me", reply("me"))
+	r.Get("/café", reply("café"))
+	r.Post("/users", reply("created"))
+	r.Patch("/users/{id}", reply("patched"))
+	r.Get("/static/{file...}", func(w *response.Writer, req *request.Request) {
+		got = req
+		reply("static")(w, req)
+	})
+
+	t.Run("Path parameter", func(t *testing.T) {
+		out := serve(t, r, "GET /users/42?x=1 HTTP/1.1\r\n\r\n")
+		assert.True(t, strings.HasSuffix(out, "user"))
+		assert.Equal(t, "42", got.PathValue("id"))
+	})
+
+	t.Run("Encoded path", func(t *testing.T) {
+		out := serve(t, r, "GET /users/john%20doe HTTP/1.1\r\n\r\n")
+		assert.True(t, strings.HasSuffix(out, "user"))
+		assert.Equal(t, "john doe", got.PathValue("id"))
+
+		out = serve(t, r, "GET /users/a%2Fb HTTP/1.1\r\n\r\n")
+		assert.True(t, strings.HasSuffix(out, "user"))
+		assert.Equal(t, "a/b", got.PathValue("id"))
+
+		out = serve(t, r, "GET /caf%C3%A9 HTTP/1.1\r\n\r\n")
+		assert.True(t, strings.HasSuffix(out, "café"))
+	})
+
+	t.Run("Static segment preferred over parameter", func(t *testing.T) {
+		out := serve(t, r, "GET /users/me HTTP/1.1\r\n\r\n")
+		assert.True(t, strings.HasSuffix(out, "me"))
+	})
+
+	t.Run("Wildcard", func(t *testing.T) {
+		out := serve(t, r, "GET /static/css/site.css HTTP/1.1\r\n\r\n")
+		assert.True(t, strings.HasSuffix(out, "static"))
+		assert.Equal(t, "css/site.css", got.PathValue("file"))
+	})
+
+	t.Run("Method not allowed", func(t *testing.T) {
+		out := serve(t, r, "DELETE /users HTTP/1.1\r\n\r\n")
+		assert.True(t, strings.HasPrefix(out, "HTTP/1.1 405 Method Not Allowed\r\n"))
+		assert.Contains(t, out, "allow: OPTIONS, POST\r\n")
+	})
+
+	t.Run("HEAD falls back to GET", func(t *testing.T) {
+		out := serve(t, r, "HEAD /users/7 HTTP/1.1\r\n\r\n")
+		assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"))
+		assert.Equal(t, "HEAD", got.RequestLine.Method)
+		assert.Equal(t, "7", got.PathValue("id"))
+	})
+
+	t.Run("OPTIONS", func(t *testing.T) {
+		out := serve(t, r, "OPTIONS /users/7 HTTP/1.1\r\n\r\n")
+		assert.True(t, strings.HasPrefix(out, "HTTP/1.1 204 No Content\r\n"))
+		assert.Contains(t, out, "allow: GET, HEAD, OPTIONS, PATCH\r\n")
+
+		out = serve(t, r, "OPTIONS * HTTP/1.1\r\n\r\n")
+		assert.True(t, strings.HasPrefix(out, "HTTP/1.1 204 No Content\r\n"))
+		assert.Contains(t, out, "allow: GET, HEAD, OPTIONS, PATCH, POST\r\n")
+
+		out = serve(t, r, "OPTIONS /nothing HTTP/1.1\r\n\r\n")
+		assert.True(t, strings.HasPrefix(out, "HTTP/1.1 404 Not Found\r\n"))
+	})
+
+	t.Run("Extension method", func(t *testing.T) {
+		out := serve(t, r, "PATCH /users/7 HTTP/1.1\r\n\r\n")
+		assert.True(t, strings.HasSuffix(out, "patched"))
+		out = serve(t, r, "PURGE /users/7 HTTP/1.1\r\n\r\n")
+		assert.True(t, strings.HasPrefix(out, "HTTP/1.1 405 Method Not Allowed\r\n"))
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		out := serve(t, r, "GET /nothing/here HTTP/1.1\r\n\r\n")
+		assert.True(t, strings.HasPrefix(out, "HTTP/1.1 404 Not Found\r\n"))
+	})
+}
+
+func TestGroupMiddleware(t *testing.T) {
+	var calls []string
+	tag := func(name string) server.Middleware {
+		return func(next server.Handler) server.Handler {
+			return func(w *response.Writer, req *request.Request) {
+				calls = append(calls, name)
+				next(w, req)
+			}
+		}
+	}
+
+	r := New()
+	r.Use(tag("root"))
+	api := r.Group("/api")
+	api.Use(tag("api"))
+	api.Get("/items/{id}", reply("item"))
+	r.Get("/health", reply("ok"))
+
+	out := serve(t, r, "GET /api/items/7 HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasSuffix(out, "item"))
+	assert.Equal(t, []string{"root", "api"}, calls)
+
+	calls = nil
+	out = serve(t, r, "GET /health HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasSuffix(out, "ok"))
+	assert.Equal(t, []string{"root"}, calls)
+
+	assert.Panics(t, func() { r.Get("/bad/{", reply("")) })
+}
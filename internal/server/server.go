@@ -1,11 +1,26 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"http/internal/headers"
 	"http/internal/request"
 	"http/internal/response"
+	"io"
 	"net"
+	"runtime/debug"
+	"sync"
 	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultIdleTimeout       = 60 * time.Second
+	DefaultReadHeaderTimeout = 10 * time.Second
+
+	errorWriteTimeout = 5 * time.Second
+	lingerTimeout     = 500 * time.Millisecond
+	lingerMaxBytes    = 256 << 10
 )
 
 type Server struct {
@@ -13,33 +28,207 @@ type Server struct {
 	closed   atomic.Bool
 	listener net.Listener
 	handler  Handler
+
+	idleTimeout       time.Duration
+	readHeaderTimeout time.Duration
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	maxRequests       int
+	bufferBody        bool
+	decodeBody        bool
+	maxDecodedBytes   int64
+	limits            request.Limits
+
+	mu    sync.Mutex
+	conns map[net.Conn]connState
 }
 
 type HandlerError struct {
 	StatusCode response.StatusCode
 	Message    string
+	// Header holds extra fields to send with the error, like the
+	// content-range of a 416.
+	Header *headers.Headers
+}
+
+func (e *HandlerError) Error() string {
+	return fmt.Sprintf("%d: %s", e.StatusCode, e.Message)
+}
+
+// Write sends the error as a complete plain text response.
+func (e *HandlerError) Write(w *response.Writer) error {
+	if err := w.WriteStatusLine(e.StatusCode); err != nil {
+		return err
+	}
+	h := response.GetDefaultHeaders(len(e.Message))
+	if e.Header != nil {
+		for _, f := range e.Header.Fields() {
+			h.Add(f.Name, f.Value)
+		}
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		return err
+	}
+	_, err := w.WriteBody([]byte(e.Message))
+	return err
 }
 
 type Handler func(w *response.Writer, req *request.Request)
 
-func Serve(port int, handler Handler) (*Server, error) {
+// ErrorHandler is a Handler that can fail. Use HandleErrors to turn it into a
+// Handler.
+type ErrorHandler func(w *response.Writer, req *request.Request) error
+
+// HandleErrors writes the error returned by h as the response. A *HandlerError
+// keeps its status code and message, errors from reading the request body get
+// the same status the server uses for parse failures, and anything else
+// becomes a 500. Anything h buffered is discarded, but if part of the response
+// had already been sent the connection is closed instead.
+func HandleErrors(h ErrorHandler) Handler {
+	return func(w *response.Writer, req *request.Request) {
+		err := h(w, req)
+		if err == nil {
+			return
+		}
+		if !w.Reset() {
+			fmt.Printf("Error after response started: %v\n", err)
+			w.SetKeepAlive(false)
+			return
+		}
+		var handlerErr *HandlerError
+		if !errors.As(err, &handlerErr) {
+			// The rest of a body that failed to parse can't be skipped
+			if handlerErr = parseErrorResponse(err); handlerErr != nil {
+				w.SetKeepAlive(false)
+			}
+		}
+		if handlerErr == nil {
+			fmt.Printf("Error handling request: %v\n", err)
+			handlerErr = internalError
+		}
+		handlerErr.Write(w)
+	}
+}
+
+var internalError = &HandlerError{
+	StatusCode: response.StatusCode500,
+	Message:    "Internal Server Error",
+}
+
+type Middleware func(Handler) Handler
+
+// Chain composes middleware so that the first one listed is the outermost.
+func Chain(mws ...Middleware) Middleware {
+	return func(h Handler) Handler {
+		for i := len(mws) - 1; i >= 0; i-- {
+			h = mws[i](h)
+		}
+		return h
+	}
+}
+
+type Option func(*Server)
+
+// WithIdleTimeout sets how long a keep-alive connection may sit idle between
+// requests before it is closed. Zero disables the timeout.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.idleTimeout = d
+	}
+}
+
+// WithReadHeaderTimeout bounds how long a client may take to send the request
+// line and headers once it starts a request. The client is sent a 408 when it
+// fires. Zero disables the timeout.
+func WithReadHeaderTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.readHeaderTimeout = d
+	}
+}
+
+// WithReadTimeout bounds how long the request body may take to read, starting
+// once the headers have been read. Zero disables the timeout.
+func WithReadTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.readTimeout = d
+	}
+}
+
+// WithWriteTimeout bounds how long writing the response may take, starting
+// once the request headers have been read. Zero disables the timeout.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.writeTimeout = d
+	}
+}
+
+// WithMaxRequestsPerConn limits how many requests are served on a single
+// connection before it is closed. Zero means no limit.
+func WithMaxRequestsPerConn(n int) Option {
+	return func(s *Server) {
+		s.maxRequests = n
+	}
+}
+
+// WithLimits overrides request.DefaultLimits for requests read by the server.
+func WithLimits(limits request.Limits) Option {
+	return func(s *Server) {
+		s.limits = limits
+	}
+}
+
+// WithBufferedBody reads each request body into Request.Body before the
+// handler runs instead of leaving it to be streamed from Request.BodyReader.
+func WithBufferedBody() Option {
+	return func(s *Server) {
+		s.bufferBody = true
+	}
+}
+
+// WithBodyDecoding undoes the gzip or deflate content-encoding of request
+// bodies before the handler reads them, failing with 413 once a body decodes
+// to more than maxBytes. Zero means no limit. Bodies in other encodings are
+// rejected with 415.
+func WithBodyDecoding(maxBytes int64) Option {
+	return func(s *Server) {
+		s.decodeBody = true
+		s.maxDecodedBytes = maxBytes
+	}
+}
+
+func Serve(port int, handler Handler, opts ...Option) (*Server, error) {
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return nil, err
 	}
-	s := &Server{port: port, listener: listener}
+	s := &Server{
+		port:              port,
+		listener:          listener,
+		idleTimeout:       DefaultIdleTimeout,
+		readHeaderTimeout: DefaultReadHeaderTimeout,
+		limits:            request.DefaultLimits,
+		conns:             make(map[net.Conn]connState),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
 	s.closed.Store(false)
 	s.handler = handler
 	go s.listen()
 	return s, nil
 }
 
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Close stops accepting connections and closes every open connection
+// immediately. Use Shutdown to let in-flight requests finish.
 func (s *Server) Close() error {
-	if err := s.listener.Close(); err != nil {
-		return err
-	}
 	s.closed.Store(true)
-	return nil
+	err := s.listener.Close()
+	s.closeConns(false)
+	return err
 }
 
 func (s *Server) listen() {
@@ -49,24 +238,201 @@ func (s *Server) listen() {
 		}
 		conn, err := s.listener.Accept()
 		if err != nil {
+			if s.closed.Load() {
+				return
+			}
 			fmt.Printf("Error accepting connection: %v\n", err)
 			return
 		}
 		fmt.Printf("Accepted connection from %v\n", conn.RemoteAddr())
+		// Tracked before checking closed, so a Shutdown that started since
+		// Accept either finds the connection or is seen here
+		s.trackConn(conn, stateIdle)
+		if s.closed.Load() {
+			s.untrackConn(conn)
+			conn.Close()
+			return
+		}
 		go s.handle(conn)
 	}
 }
 
 func (s *Server) handle(conn net.Conn) {
 	defer conn.Close()
+	defer s.untrackConn(conn)
 
-	req, err := request.RequestFromReader(conn)
-	if err != nil {
-		fmt.Printf("Error reading request: %v\n", err)
-		return
+	reader := request.NewReader(conn)
+	reader.Limits = s.limits
+	for served := 0; ; served++ {
+		// The first request gets the header timeout from the moment the
+		// connection is accepted, later ones once they start arriving.
+		if served > 0 {
+			s.trackConn(conn, stateIdle)
+			setReadDeadline(conn, s.idleTimeout)
+		} else {
+			setReadDeadline(conn, s.readHeaderTimeout)
+		}
+		if err := reader.WaitForRequest(); err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) && !errors.Is(err, request.ErrUnreadBody) && !isTimeout(err) {
+				fmt.Printf("Error reading request: %v\n", err)
+			}
+			return
+		}
+		// A request has started arriving, so Shutdown has to wait for it
+		s.trackConn(conn, stateActive)
+		if served > 0 {
+			setReadDeadline(conn, s.readHeaderTimeout)
+		}
+
+		req, err := reader.ReadRequest()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) && !isTimeout(err) {
+				fmt.Printf("Error reading request: %v\n", err)
+			}
+			writeParseError(conn, err)
+			return
+		}
+		setReadDeadline(conn, s.readTimeout)
+		if s.writeTimeout > 0 {
+			conn.SetWriteDeadline(time.Now().Add(s.writeTimeout))
+		}
+		if s.decodeBody {
+			if err := req.DecodeBody(s.maxDecodedBytes); err != nil {
+				fmt.Printf("Error decoding request body: %v\n", err)
+				writeParseError(conn, err)
+				return
+			}
+		}
+		if s.bufferBody {
+			if err := req.BufferBody(); err != nil {
+				fmt.Printf("Error reading request body: %v\n", err)
+				writeParseError(conn, err)
+				return
+			}
+		}
+
+		w := response.NewBufferedWriter(conn)
+		w.SetKeepAlive(s.keepAlive(req, served+1))
+		if req.RequestLine.Method == "HEAD" {
+			w.SuppressBody()
+		}
+		w.BeforeHeaders(func() {
+			// Shutdown may have started while the handler was running, and
+			// a large body the handler left unread can't be skipped to reach
+			// the next request
+			if s.closed.Load() || !reader.CanDiscardBody() {
+				w.SetKeepAlive(false)
+			}
+		})
+		s.serveRequest(w, req)
+		if err := w.Finish(); err != nil {
+			fmt.Printf("Error finishing response: %v\n", err)
+			return
+		}
+		if err := w.Flush(); err != nil {
+			fmt.Printf("Error writing response: %v\n", err)
+			return
+		}
+		if !w.KeepAlive() {
+			return
+		}
 	}
+}
 
-	w := response.NewWriter(conn)
+// serveRequest runs the handler, turning a panic into a 500 response if
+// nothing has been sent yet. The connection is closed either way.
+func (s *Server) serveRequest(w *response.Writer, req *request.Request) {
+	defer func() {
+		rec := recover()
+		if rec == nil {
+			return
+		}
+		fmt.Printf("Panic serving %s: %v\n%s", req.RequestLine.RequestTarget, rec, debug.Stack())
+		w.SetKeepAlive(false)
+		if w.Reset() {
+			internalError.Write(w)
+		}
+	}()
 	s.handler(w, req)
-	return
+}
+
+func (s *Server) keepAlive(req *request.Request, served int) bool {
+	if s.closed.Load() {
+		return false
+	}
+	if s.maxRequests > 0 && served >= s.maxRequests {
+		return false
+	}
+	return !req.Headers.HasToken("connection", "close")
+}
+
+var parseErrors = []struct {
+	err        error
+	statusCode response.StatusCode
+}{
+	{request.ErrRequestLineTooLong, response.StatusCode414},
+	{request.ErrBodyTooLarge, response.StatusCode413},
+	{headers.ErrHeaderTooLarge, response.StatusCode431},
+	{headers.ErrTooManyHeaders, response.StatusCode431},
+	{request.ErrUnsupportedVersion, response.StatusCode505},
+	{request.ErrUnsupportedEncoding, response.StatusCode501},
+	{request.ErrUnsupportedContentEncoding, response.StatusCode415},
+	{request.ErrInvalidEncodedBody, response.StatusCode400},
+	{request.ErrInvalidRequestLine, response.StatusCode400},
+	{request.ErrInvalidContentLength, response.StatusCode400},
+	{request.ErrInvalidFraming, response.StatusCode400},
+	{request.ErrInvalidChunk, response.StatusCode400},
+	{headers.ErrInvalidHeader, response.StatusCode400},
+}
+
+// writeParseError tells the client why its request was rejected before the
+// connection is closed. Errors that aren't the client's fault, like the
+// connection dropping, get no response.
+func writeParseError(conn net.Conn, err error) {
+	handlerErr := parseErrorResponse(err)
+	if handlerErr == nil {
+		return
+	}
+	conn.SetWriteDeadline(time.Now().Add(errorWriteTimeout))
+	w := response.NewBufferedWriter(conn)
+	if handlerErr.Write(w) == nil && w.Flush() == nil {
+		lingeringClose(conn)
+	}
+}
+
+func parseErrorResponse(err error) *HandlerError {
+	if isTimeout(err) {
+		return &HandlerError{StatusCode: response.StatusCode408, Message: "request timeout"}
+	}
+	for _, pe := range parseErrors {
+		if errors.Is(err, pe.err) {
+			return &HandlerError{StatusCode: pe.statusCode, Message: pe.err.Error()}
+		}
+	}
+	return nil
+}
+
+// lingeringClose stops writing and discards what the client is still sending
+// for a moment, so the close doesn't reset the connection and throw away the
+// response before the client has read it.
+func lingeringClose(conn net.Conn) {
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.CloseWrite()
+	}
+	conn.SetReadDeadline(time.Now().Add(lingerTimeout))
+	io.Copy(io.Discard, io.LimitReader(conn, lingerMaxBytes))
+}
+
+// setReadDeadline sets the deadline d from now, or clears it if d is zero.
+func setReadDeadline(conn net.Conn, d time.Duration) {
+	if d > 0 {
+		conn.SetReadDeadline(time.Now().Add(d))
+	} else {
+		conn.SetReadDeadline(time.Time{})
+	}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
 }
@@ -0,0 +1,468 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"http/internal/request"
+	"http/internal/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startServer(t *testing.T, handler Handler, opts ...Option) *Server {
+	s, err := Serve(0, handler, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func dial(t *testing.T, s *Server) net.Conn {
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readResponse reads one content-length framed response off the connection.
+func readResponse(t *testing.T, r *bufio.Reader) (string, map[string]string, string) {
+	statusLine, err := r.ReadString('\n')
+	require.NoError(t, err)
+	h := map[string]string{}
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		k, v, _ := strings.Cut(line, ": ")
+		h[k] = v
+	}
+	var n int
+	fmt.Sscanf(h["content-length"], "%d", &n)
+	body := make([]byte, n)
+	_, err = io.ReadFull(r, body)
+	require.NoError(t, err)
+	return strings.TrimRight(statusLine, "\r\n"), h, string(body)
+}
+
+func hello(w *response.Writer, req *request.Request) {
+	msg := "hello " + req.RequestLine.RequestTarget
+	w.WriteStatusLine(response.StatusCode200)
+	w.WriteHeaders(response.GetDefaultHeaders(len(msg)))
+	w.WriteBody([]byte(msg))
+}
+
+func TestKeepAlive(t *testing.T) {
+	s := startServer(t, hello, WithMaxRequestsPerConn(2))
+	conn := dial(t, s)
+	r := bufio.NewReader(conn)
+
+	fmt.Fprintf(conn, "GET /one HTTP/1.1\r\n\r\nGET /two HTTP/1.1\r\n\r\n")
+	status, h, body := readResponse(t, r)
+	assert.Equal(t, "HTTP/1.1 200 OK", status)
+	assert.Equal(t, "keep-alive", h["connection"])
+	assert.Equal(t, "hello /one", body)
+
+	_, h, body = readResponse(t, r)
+	assert.Equal(t, "close", h["connection"])
+	assert.Equal(t, "hello /two", body)
+
+	_, err := r.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestContentLengthMismatch(t *testing.T) {
+	s := startServer(t, func(w *response.Writer, req *request.Request) {
+		w.Header().Set("content-length", "10")
+		w.Write([]byte("abc"))
+	})
+	conn := dial(t, s)
+	r := bufio.NewReader(conn)
+
+	// The short body is followed by the connection closing, since the
+	// client would read the next response as the rest of it
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\n\r\n")
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(out), "\r\n\r\nabc"))
+}
+
+func TestUnreadBody(t *testing.T) {
+	s := startServer(t, hello)
+	conn := dial(t, s)
+	r := bufio.NewReader(conn)
+
+	// A small unread body is skipped to reach the next request
+	fmt.Fprintf(conn, "POST /one HTTP/1.1\r\nContent-Length: 5\r\n\r\nhelloGET /two HTTP/1.1\r\n\r\n")
+	_, h, _ := readResponse(t, r)
+	assert.Equal(t, "keep-alive", h["connection"])
+	_, h, body := readResponse(t, r)
+	assert.Equal(t, "keep-alive", h["connection"])
+	assert.Equal(t, "hello /two", body)
+
+	// One too large to skip closes the connection, and the response says so
+	fmt.Fprintf(conn, "POST /three HTTP/1.1\r\nContent-Length: %d\r\n\r\n", 300<<10)
+	_, h, _ = readResponse(t, r)
+	assert.Equal(t, "close", h["connection"])
+	_, err := r.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestPanicRecovery(t *testing.T) {
+	s := startServer(t, func(w *response.Writer, req *request.Request) {
+		// Buffered output is discarded in favour of the 500
+		w.WriteHeader(response.StatusCode201)
+		w.Write([]byte("partial"))
+		panic("boom")
+	})
+	conn := dial(t, s)
+	r := bufio.NewReader(conn)
+
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\n\r\n")
+	status, h, _ := readResponse(t, r)
+	assert.Equal(t, "HTTP/1.1 500 Internal Server Error", status)
+	assert.Equal(t, "close", h["connection"])
+}
+
+func TestImplicitResponse(t *testing.T) {
+	s := startServer(t, func(w *response.Writer, req *request.Request) {
+		w.Write([]byte("hello "))
+		w.Write([]byte(req.RequestLine.RequestTarget))
+	})
+	conn := dial(t, s)
+	r := bufio.NewReader(conn)
+
+	fmt.Fprintf(conn, "GET /one HTTP/1.1\r\n\r\nGET /two HTTP/1.1\r\n\r\n")
+	status, h, body := readResponse(t, r)
+	assert.Equal(t, "HTTP/1.1 200 OK", status)
+	assert.Equal(t, "keep-alive", h["connection"])
+	assert.Equal(t, "hello /one", body)
+
+	_, _, body = readResponse(t, r)
+	assert.Equal(t, "hello /two", body)
+
+	// A handler that writes nothing still gets a response
+	s = startServer(t, func(w *response.Writer, req *request.Request) {})
+	conn = dial(t, s)
+	r = bufio.NewReader(conn)
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\n\r\nGET / HTTP/1.1\r\n\r\n")
+	for range 2 {
+		status, h, body = readResponse(t, r)
+		assert.Equal(t, "HTTP/1.1 200 OK", status)
+		assert.Equal(t, "0", h["content-length"])
+		assert.Equal(t, "keep-alive", h["connection"])
+		assert.Empty(t, body)
+	}
+}
+
+func TestHandleErrors(t *testing.T) {
+	s := startServer(t, HandleErrors(func(w *response.Writer, req *request.Request) error {
+		if req.RequestLine.RequestTarget == "/bad" {
+			return &HandlerError{StatusCode: response.StatusCode400, Message: "bad input"}
+		}
+		w.Header().Set("content-type", "image/png")
+		w.Header().Set("content-encoding", "gzip")
+		w.Header().Set("transfer-encoding", "chunked")
+		w.Header().Set("etag", `"v1"`)
+		w.Header().Set("x-trace", "abc")
+		return fmt.Errorf("something broke")
+	}))
+	conn := dial(t, s)
+	r := bufio.NewReader(conn)
+
+	fmt.Fprintf(conn, "GET /bad HTTP/1.1\r\n\r\n")
+	status, h, body := readResponse(t, r)
+	assert.Equal(t, "HTTP/1.1 400 Bad Request", status)
+	assert.Equal(t, "keep-alive", h["connection"])
+	assert.Equal(t, "bad input", body)
+
+	fmt.Fprintf(conn, "GET /other HTTP/1.1\r\n\r\n")
+	status, h, body = readResponse(t, r)
+	assert.Equal(t, "HTTP/1.1 500 Internal Server Error", status)
+	assert.Equal(t, "Internal Server Error", body)
+
+	// Headers describing the body the handler meant to send are dropped
+	assert.Equal(t, "text/plain", h["content-type"])
+	assert.NotContains(t, h, "content-encoding")
+	assert.NotContains(t, h, "transfer-encoding")
+	assert.NotContains(t, h, "etag")
+	assert.Equal(t, "abc", h["x-trace"])
+}
+
+func TestShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s := startServer(t, func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/slow" {
+			close(started)
+			<-release
+		}
+		hello(w, req)
+	})
+
+	idle := dial(t, s)
+	idleReader := bufio.NewReader(idle)
+	fmt.Fprintf(idle, "GET /fast HTTP/1.1\r\n\r\n")
+	readResponse(t, idleReader)
+
+	busy := dial(t, s)
+	busyReader := bufio.NewReader(busy)
+	fmt.Fprintf(busy, "GET /slow HTTP/1.1\r\n\r\n")
+	<-started
+
+	done := make(chan error)
+	go func() {
+		done <- s.Shutdown(context.Background())
+	}()
+
+	// Idle keep-alive connection is closed right away
+	_, err := idleReader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	select {
+	case <-done:
+		t.Fatal("Shutdown returned before the in-flight request finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	_, h, body := readResponse(t, busyReader)
+	assert.Equal(t, "hello /slow", body)
+	assert.Equal(t, "close", h["connection"])
+	require.NoError(t, <-done)
+
+	_, err = net.Dial("tcp", s.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestShutdownPartialRequest(t *testing.T) {
+	s := startServer(t, hello)
+	conn := dial(t, s)
+	r := bufio.NewReader(conn)
+
+	// A request whose headers are still arriving is in flight, not idle
+	fmt.Fprintf(conn, "GET /partial HTTP/1.1\r\n")
+	time.Sleep(50 * time.Millisecond)
+	done := make(chan error)
+	go func() {
+		done <- s.Shutdown(context.Background())
+	}()
+	select {
+	case <-done:
+		t.Fatal("Shutdown returned before the in-flight request finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	fmt.Fprintf(conn, "\r\n")
+	_, h, body := readResponse(t, r)
+	assert.Equal(t, "hello /partial", body)
+	assert.Equal(t, "close", h["connection"])
+	require.NoError(t, <-done)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	s := startServer(t, func(w *response.Writer, req *request.Request) {
+		close(started)
+		time.Sleep(time.Second)
+	})
+
+	conn := dial(t, s)
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\n\r\n")
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := s.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Straggler was force-closed
+	_, err = bufio.NewReader(conn).ReadByte()
+	assert.Error(t, err)
+}
+
+func TestParseErrorResponses(t *testing.T) {
+	s := startServer(t, hello)
+	tests := []struct {
+		name   string
+		raw    string
+		status string
+	}{
+		{"Malformed request line", "GET /\r\n\r\n", "HTTP/1.1 400 Bad Request"},
+		{"Unsupported version", "GET / HTTP/2.0\r\n\r\n", "HTTP/1.1 505 HTTP Version Not Supported"},
+		{"Malformed method", "BR{EW} / HTTP/1.1\r\n\r\n", "HTTP/1.1 400 Bad Request"},
+		{"Bad content-length", "POST / HTTP/1.1\r\nContent-Length: abc\r\n\r\n", "HTTP/1.1 400 Bad Request"},
+		{"Unsupported transfer coding", "POST / HTTP/1.1\r\nTransfer-Encoding: gzip, chunked\r\n\r\n", "HTTP/1.1 501 Not Implemented"},
+		{"Malformed header", "GET / HTTP/1.1\r\nHost localhost\r\n\r\n", "HTTP/1.1 400 Bad Request"},
+		{"Request line too long", "GET /" + strings.Repeat("a", 10000) + " HTTP/1.1\r\n\r\n", "HTTP/1.1 414 URI Too Long"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := dial(t, s)
+			r := bufio.NewReader(conn)
+			fmt.Fprint(conn, tc.raw)
+			status, h, _ := readResponse(t, r)
+			assert.Equal(t, tc.status, status)
+			assert.Equal(t, "close", h["connection"])
+			_, err := io.ReadAll(r)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	s := startServer(t, hello,
+		WithIdleTimeout(100*time.Millisecond),
+		WithReadHeaderTimeout(100*time.Millisecond),
+	)
+
+	// Test: Slow headers get a 408
+	conn := dial(t, s)
+	r := bufio.NewReader(conn)
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: loc")
+	status, h, _ := readResponse(t, r)
+	assert.Equal(t, "HTTP/1.1 408 Request Timeout", status)
+	assert.Equal(t, "close", h["connection"])
+
+	// Test: Idle keep-alive connection is closed without a response
+	conn = dial(t, s)
+	r = bufio.NewReader(conn)
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\n\r\n")
+	_, _, body := readResponse(t, r)
+	assert.Equal(t, "hello /", body)
+	_, err := r.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: Header timeout restarts for each request
+	conn = dial(t, s)
+	r = bufio.NewReader(conn)
+	fmt.Fprint(conn, "GET /a HTTP/1.1\r\n\r\n")
+	readResponse(t, r)
+	time.Sleep(60 * time.Millisecond)
+	fmt.Fprint(conn, "GET /b HTTP/1.1\r\n")
+	time.Sleep(60 * time.Millisecond)
+	fmt.Fprint(conn, "\r\n")
+	_, _, body = readResponse(t, r)
+	assert.Equal(t, "hello /b", body)
+}
+
+func TestLimits(t *testing.T) {
+	s := startServer(t, HandleErrors(func(w *response.Writer, req *request.Request) error {
+		if _, err := io.ReadAll(req.BodyReader); err != nil {
+			return err
+		}
+		hello(w, req)
+		return nil
+	}), WithLimits(request.Limits{MaxHeaderCount: 2, MaxBodyBytes: 8}))
+
+	conn := dial(t, s)
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n")
+	status, _, _ := readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, "HTTP/1.1 431 Request Header Fields Too Large", status)
+
+	conn = dial(t, s)
+	fmt.Fprint(conn, "POST / HTTP/1.1\r\nContent-Length: 9\r\n\r\n123456789")
+	status, _, _ = readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, "HTTP/1.1 413 Content Too Large", status)
+
+	conn = dial(t, s)
+	fmt.Fprint(conn, "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\n12345\r\n5\r\n67890\r\n0\r\n\r\n")
+	status, h, _ := readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, "HTTP/1.1 413 Content Too Large", status)
+	assert.Equal(t, "close", h["connection"])
+}
+
+func TestBodyDecoding(t *testing.T) {
+	echo := HandleErrors(func(w *response.Writer, req *request.Request) error {
+		body, err := io.ReadAll(req.BodyReader)
+		if err != nil {
+			return err
+		}
+		w.Write(body)
+		return nil
+	})
+	s := startServer(t, echo, WithBodyDecoding(16))
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("hello"))
+	zw.Close()
+	conn := dial(t, s)
+	r := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "POST / HTTP/1.1\r\nContent-Encoding: gzip\r\nContent-Length: %d\r\n\r\n%s", buf.Len(), buf.String())
+	status, _, body := readResponse(t, r)
+	assert.Equal(t, "HTTP/1.1 200 OK", status)
+	assert.Equal(t, "hello", body)
+
+	fmt.Fprint(conn, "POST / HTTP/1.1\r\nContent-Encoding: br\r\nContent-Length: 4\r\n\r\ndata")
+	status, h, _ := readResponse(t, r)
+	assert.Equal(t, "HTTP/1.1 415 Unsupported Media Type", status)
+	assert.Equal(t, "close", h["connection"])
+
+	buf.Reset()
+	zw = gzip.NewWriter(&buf)
+	zw.Write([]byte(strings.Repeat("a", 100)))
+	zw.Close()
+	conn = dial(t, s)
+	fmt.Fprintf(conn, "POST / HTTP/1.1\r\nContent-Encoding: gzip\r\nContent-Length: %d\r\n\r\n%s", buf.Len(), buf.String())
+	status, _, _ = readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, "HTTP/1.1 413 Content Too Large", status)
+}
+
+func TestHead(t *testing.T) {
+	s := startServer(t, func(w *response.Writer, req *request.Request) {
+		w.Write([]byte(strings.Repeat("x", 10000)))
+	})
+	conn := dial(t, s)
+	r := bufio.NewReader(conn)
+
+	// The body of a chunked response is dropped along with its terminator,
+	// leaving the connection ready for the next request
+	fmt.Fprintf(conn, "HEAD / HTTP/1.1\r\n\r\nGET / HTTP/1.1\r\n\r\n")
+	var head strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		head.WriteString(line)
+		if line == "\r\n" {
+			break
+		}
+	}
+	assert.True(t, strings.HasPrefix(head.String(), "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, head.String(), "transfer-encoding: chunked\r\n")
+	assert.Contains(t, head.String(), "connection: keep-alive\r\n")
+	status, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", status)
+
+	s2 := startServer(t, hello)
+	conn = dial(t, s2)
+	r = bufio.NewReader(conn)
+	fmt.Fprintf(conn, "HEAD /one HTTP/1.1\r\n\r\nGET /two HTTP/1.1\r\n\r\n")
+	status, err = r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", status)
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\r\n" {
+			break
+		}
+		if k, v, _ := strings.Cut(strings.TrimRight(line, "\r\n"), ": "); k == "content-length" {
+			assert.Equal(t, "10", v)
+		}
+	}
+	_, _, body := readResponse(t, r)
+	assert.Equal(t, "hello /two", body)
+}
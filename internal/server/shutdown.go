@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+type connState int
+
+const (
+	// stateIdle covers connections waiting for their next request.
+	stateIdle connState = iota
+	stateActive
+)
+
+const shutdownPollInterval = 50 * time.Millisecond
+
+// Shutdown stops accepting connections, closes idle keep-alive connections and
+// waits for in-flight requests to finish. Once ctx expires any remaining
+// connections are closed and ctx.Err() is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closed.Store(true)
+	err := s.listener.Close()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeConns(true) == 0 {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			s.closeConns(false)
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) trackConn(conn net.Conn, state connState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[conn] = state
+}
+
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
+// closeConns closes tracked connections, only idle ones if idleOnly is set,
+// and reports how many are left open.
+func (s *Server) closeConns(idleOnly bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn, state := range s.conns {
+		if idleOnly && state != stateIdle {
+			continue
+		}
+		conn.Close()
+		delete(s.conns, conn)
+	}
+	return len(s.conns)
+}